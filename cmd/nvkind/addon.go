@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"strings"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+)
+
+func BuildAddonCommand() *cli.Command {
+	cmd := cli.Command{}
+	cmd.Name = "addon"
+	cmd.Usage = "perform operations on NVIDIA addons of clusters with NVIDIA GPUs"
+	cmd.Subcommands = []*cli.Command{
+		BuildAddonInstallCommand(),
+	}
+	return &cmd
+}
+
+// newAddon returns the addon described by spec, which is either the name of
+// an addon or <name>=<path> to install it from a local chart or manifest.
+func newAddon(spec string, values []string) (*nvkind.Addon, error) {
+	name, source, _ := strings.Cut(spec, "=")
+
+	opts := []nvkind.AddonOption{
+		nvkind.WithAddonValues(values...),
+	}
+	if source != "" {
+		opts = append(opts, nvkind.WithAddonSource(source))
+	}
+
+	return nvkind.NewAddon(name, opts...)
+}
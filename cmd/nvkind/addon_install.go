@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+)
+
+type AddonInstallFlags struct {
+	Cluster ClusterFlags
+	Values  cli.StringSlice
+}
+
+func BuildAddonInstallCommand() *cli.Command {
+	flags := AddonInstallFlags{}
+
+	cmd := cli.Command{}
+	cmd.Name = "install"
+	cmd.Usage = "install NVIDIA addons on a cluster"
+	cmd.ArgsUsage = fmt.Sprintf("<addon>[=<path to local chart or manifest>]... (addons: %s)", strings.Join(nvkind.AddonNames(), ", "))
+	cmd.Action = func(ctx *cli.Context) error {
+		return runAddonInstall(ctx, &flags)
+	}
+
+	cmd.Flags = []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "set",
+			Usage:       "a helm value (key=value) to set on the addons, overriding those derived from the cluster (may be repeated)",
+			Destination: &flags.Values,
+		},
+	}
+
+	cmd.Flags = append(cmd.Flags, flags.Cluster.flags("the name of the cluster to install addons on")...)
+
+	return &cmd
+}
+
+func runAddonInstall(c *cli.Context, f *AddonInstallFlags) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("at least one addon is required")
+	}
+
+	var addons []*nvkind.Addon
+	for _, spec := range c.Args().Slice() {
+		addon, err := newAddon(spec, f.Values.Value())
+		if err != nil {
+			return fmt.Errorf("getting addon: %w", err)
+		}
+		addons = append(addons, addon)
+	}
+
+	cluster, err := f.Cluster.getCluster(c.Context, nvkind.WithConfigOptions(outputConfigOptions(c)...))
+	if err != nil {
+		return err
+	}
+
+	for _, addon := range addons {
+		if err := cluster.InstallAddon(c.Context, addon); err != nil {
+			return fmt.Errorf("installing addon '%v': %w", addon.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -26,8 +26,13 @@ func BuildClusterCommand() *cli.Command {
 	cmd.Usage = "perform operations on cluster with NVIDIA GPUs"
 	cmd.Subcommands = []*cli.Command{
 		BuildClusterListCommand(),
+		BuildClusterCheckCommand(),
 		BuildClusterCreateCommand(),
+		BuildClusterDescribeCommand(),
+		BuildClusterProvisionCommand(),
+		BuildClusterReconcileCommand(),
 		BuildClusterPrintGPUsCommand(),
+		BuildClusterVerifyCommand(),
 	}
 	return &cmd
 }
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+)
+
+type ClusterCheckFlags struct {
+	Cluster ClusterFlags
+	Output  string
+}
+
+func BuildClusterCheckCommand() *cli.Command {
+	flags := ClusterCheckFlags{}
+
+	cmd := cli.Command{}
+	cmd.Name = "check"
+	cmd.Usage = "check that each worker of a cluster still has the same host GPUs it was created with"
+	cmd.Action = func(ctx *cli.Context) error {
+		return runClusterCheck(ctx, &flags)
+	}
+
+	cmd.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:        "output",
+			Aliases:     []string{"o"},
+			Usage:       "the format of the report (text or json)",
+			Value:       "text",
+			Destination: &flags.Output,
+		},
+	}
+
+	cmd.Flags = append(cmd.Flags, flags.Cluster.flags("the name of the cluster to check")...)
+
+	return &cmd
+}
+
+func runClusterCheck(c *cli.Context, f *ClusterCheckFlags) error {
+	if f.Output != "text" && f.Output != "json" {
+		return fmt.Errorf("unknown output format: %v", f.Output)
+	}
+
+	cluster, err := f.Cluster.getCluster(c.Context)
+	if err != nil {
+		return err
+	}
+
+	report, err := cluster.Check(c.Context)
+	if err != nil {
+		return fmt.Errorf("checking cluster: %w", err)
+	}
+
+	switch f.Output {
+	case "json":
+		jsonData, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return fmt.Errorf("marshaling report: %w", err)
+		}
+		fmt.Println(string(jsonData))
+	default:
+		printCheckReport(report)
+	}
+
+	if !report.Passed() {
+		return fmt.Errorf("the GPUs of cluster '%v' have changed since it was created", f.Cluster.Name)
+	}
+
+	return nil
+}
+
+func printCheckReport(report *nvkind.CheckReport) {
+	if !report.Recorded {
+		fmt.Printf("Cluster '%v' was created by a version of nvkind that did not record the GPUs of its workers, so it cannot be checked.\n", report.Cluster)
+		return
+	}
+
+	if report.Passed() {
+		fmt.Printf("All workers of cluster '%v' have the same GPUs they were created with.\n", report.Cluster)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tDEVICE\tRECORDED\tCURRENT\tMESSAGE")
+	for _, drift := range report.Drift {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", drift.Node, drift.Device, drift.RecordedUUID, orNone(drift.CurrentUUID), drift.Message)
+	}
+	w.Flush()
+
+	fmt.Printf("Affected workers: %s\n", strings.Join(report.AffectedNodes(), ", "))
+	fmt.Println("Recreate the cluster to assign GPUs to these workers again. Referring to GPUs by UUID in the config template keeps assignments stable if the host reorders its GPUs.")
+}
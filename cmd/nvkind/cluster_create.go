@@ -18,22 +18,27 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
 	"github.com/urfave/cli/v2"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type ClusterCreateFlags struct {
-	Name           string
-	Image          string
-	Retain         bool
-	Wait           time.Duration
-	ConfigTemplate string
-	ConfigValues   string
-	KubeConfig     string
+	Name            string
+	Retain          bool
+	Wait            time.Duration
+	KubeConfig      string
+	Addons          cli.StringSlice
+	Labels          cli.StringSlice
+	Parallelism     int
+	DeleteOnFailure bool
+	Config          ConfigFlags
 }
 
 func BuildClusterCreateCommand() *cli.Command {
@@ -53,35 +58,41 @@ func BuildClusterCreateCommand() *cli.Command {
 			Destination: &flags.Name,
 			EnvVars:     []string{"KIND_CLUSTER_NAME"},
 		},
-		&cli.StringFlag{
-			Name:        "image",
-			Usage:       "node docker image to use for booting the cluster",
-			Destination: &flags.Image,
-			EnvVars:     []string{"KIND_CLUSTER_IMAGE"},
-		},
 		&cli.BoolFlag{
 			Name:        "retain",
 			Usage:       "retain nodes for debugging when cluster creation fails",
 			Destination: &flags.Retain,
 			EnvVars:     []string{"KIND_CLUSTER_RETAIN"},
 		},
+		&cli.BoolFlag{
+			Name:        "delete-on-failure",
+			Usage:       "delete the cluster if provisioning it fails or is interrupted after it has been created",
+			Destination: &flags.DeleteOnFailure,
+			EnvVars:     []string{"KIND_CLUSTER_DELETE_ON_FAILURE"},
+		},
 		&cli.DurationFlag{
 			Name:        "wait",
 			Usage:       "wait for control plane node to be ready",
 			Destination: &flags.Wait,
 			EnvVars:     []string{"KIND_CLUSTER_RETAIN"},
 		},
-		&cli.StringFlag{
-			Name:        "config-template",
-			Usage:       "the path to a custom kind config template",
-			Destination: &flags.ConfigTemplate,
-			EnvVars:     []string{"KIND_CLUSTER_CONFIG_TEMPLATE"},
+		&cli.IntFlag{
+			Name:        "parallelism",
+			Usage:       "the maximum number of GPU workers to provision at once (default 4)",
+			Destination: &flags.Parallelism,
+			EnvVars:     []string{"KIND_CLUSTER_PARALLELISM"},
 		},
-		&cli.StringFlag{
-			Name:        "config-values",
-			Usage:       "the path to a values file to fill in the variables from a kind config template",
-			Destination: &flags.ConfigValues,
-			EnvVars:     []string{"KIND_CLUSTER_CONFIG_VALUES"},
+		&cli.StringSliceFlag{
+			Name:        "addon",
+			Usage:       fmt.Sprintf("an addon to install once the cluster is up, as <addon>[=<path to local chart or manifest>] (may be repeated; addons: %s)", strings.Join(nvkind.AddonNames(), ", ")),
+			Destination: &flags.Addons,
+			EnvVars:     []string{"KIND_CLUSTER_ADDONS"},
+		},
+		&cli.StringSliceFlag{
+			Name:        "label",
+			Usage:       "a label to set on the cluster as <key>=<value>, which clusters can be selected by with 'nvkind cluster list --selector' (may be repeated)",
+			Destination: &flags.Labels,
+			EnvVars:     []string{"KIND_CLUSTER_LABELS"},
 		},
 		&cli.StringFlag{
 			Name:        "kubeconfig",
@@ -91,16 +102,27 @@ func BuildClusterCreateCommand() *cli.Command {
 		},
 	}
 
+	cmd.Flags = append(cmd.Flags, flags.Config.flags()...)
+
 	return &cmd
 }
 
 func runClusterCreate(c *cli.Context, f *ClusterCreateFlags) error {
-	clusterOptions, err := f.gatherClusterOptions()
+	var addons []*nvkind.Addon
+	for _, spec := range f.Addons.Value() {
+		addon, err := newAddon(spec, nil)
+		if err != nil {
+			return fmt.Errorf("getting addon: %w", err)
+		}
+		addons = append(addons, addon)
+	}
+
+	clusterOptions, err := f.gatherClusterOptions(c)
 	if err != nil {
 		return fmt.Errorf("gathering cluster options: %w", err)
 	}
 
-	cluster, err := nvkind.NewCluster(clusterOptions...)
+	cluster, err := nvkind.NewCluster(c.Context, clusterOptions...)
 	if err != nil {
 		return fmt.Errorf("new cluster: %w", err)
 	}
@@ -110,68 +132,54 @@ func runClusterCreate(c *cli.Context, f *ClusterCreateFlags) error {
 		return fmt.Errorf("gathering cluster create options: %w", err)
 	}
 
-	if err := cluster.Create(clusterCreateOptions...); err != nil {
-		return fmt.Errorf("creating cluster: %w", err)
-	}
-
-	nodes, err := cluster.GetNodes()
-	if err != nil {
-		return fmt.Errorf("getting cluster nodes: %w", err)
+	if err := cluster.Create(c.Context, clusterCreateOptions...); err != nil {
+		return f.handleFailure(c.Context, cluster, fmt.Errorf("creating cluster: %w", err))
 	}
 
-	for _, node := range nodes {
-		if !node.HasGPUs() {
-			continue
-		}
-		if err := node.InstallContainerToolkit(); err != nil {
-			return fmt.Errorf("installing container toolkit on node '%v': %w", node.Name, err)
-		}
-		if err := node.ConfigureContainerRuntime(); err != nil {
-			return fmt.Errorf("configuring container runtime on node '%v': %w", node.Name, err)
-		}
-		if err := node.PatchProcDriverNvidia(); err != nil {
-			return fmt.Errorf("patching /proc/driver/nvidia on node '%v': %w", node.Name, err)
-		}
+	if err := provisionCluster(c.Context, cluster, addons, f); err != nil {
+		return f.handleFailure(c.Context, cluster, err)
 	}
 
 	return nil
 }
 
-func (f *ClusterCreateFlags) gatherConfigOptions() ([]nvkind.ConfigOption, error) {
-	var configOptions []nvkind.ConfigOption
-
-	if f.Image != "" {
-		configOptions = append(configOptions, nvkind.WithImage(f.Image))
+// handleFailure deletes the partially created cluster if requested and
+// returns err. A cluster that was never created by this run (e.g. because its
+// config is invalid or a cluster with the same name already exists) is never
+// deleted.
+func (f *ClusterCreateFlags) handleFailure(ctx context.Context, cluster *nvkind.Cluster, err error) error {
+	if !f.DeleteOnFailure || nvkind.IsNotCreated(err) {
+		return err
 	}
+	// Delete even if the failure was due to being interrupted
+	if deleteErr := cluster.Delete(context.WithoutCancel(ctx)); deleteErr != nil {
+		return fmt.Errorf("%w (deleting cluster: %v)", err, deleteErr)
+	}
+	return err
+}
 
-	if f.ConfigTemplate != "" {
-		configOptions = append(configOptions, nvkind.WithConfigTemplate(f.ConfigTemplate))
+// provisionCluster provisions a newly created cluster and installs the given
+// addons on it.
+func provisionCluster(ctx context.Context, cluster *nvkind.Cluster, addons []*nvkind.Addon, f *ClusterCreateFlags) error {
+	var provisionOptions []nvkind.ProvisionOption
+	if f.Parallelism != 0 {
+		provisionOptions = append(provisionOptions, nvkind.WithParallelism(f.Parallelism))
 	}
 
-	if f.ConfigValues != "" {
-		var err error
-		var configValues []byte
+	if err := cluster.Provision(ctx, provisionOptions...); err != nil {
+		return fmt.Errorf("provisioning cluster (continue with 'nvkind cluster provision --resume --name=%v'): %w", cluster.Name, err)
+	}
 
-		if f.ConfigValues == "-" {
-			scanner := bufio.NewScanner(os.Stdin)
-			for scanner.Scan() {
-				configValues = append(configValues, scanner.Bytes()...)
-				configValues = append(configValues, '\n')
-			}
-		} else {
-			configValues, err = os.ReadFile(f.ConfigValues)
-			if err != nil {
-				return nil, fmt.Errorf("reading file: %w", err)
-			}
+	for _, addon := range addons {
+		if err := cluster.InstallAddon(ctx, addon); err != nil {
+			return fmt.Errorf("installing addon '%v': %w", addon.Name, err)
 		}
-
-		configOptions = append(configOptions, nvkind.WithConfigValues(configValues))
 	}
 
-	return configOptions, nil
+	return nil
 }
 
-func (f *ClusterCreateFlags) gatherClusterOptions() ([]nvkind.ClusterOption, error) {
+func (f *ClusterCreateFlags) gatherClusterOptions(c *cli.Context) ([]nvkind.ClusterOption, error) {
 	var clusterOptions []nvkind.ClusterOption
 
 	if f.Name != "" {
@@ -182,18 +190,16 @@ func (f *ClusterCreateFlags) gatherClusterOptions() ([]nvkind.ClusterOption, err
 		clusterOptions = append(clusterOptions, nvkind.WithKubeConfig(f.KubeConfig))
 	}
 
-	configOptions, err := f.gatherConfigOptions()
+	configOptions, err := f.Config.gatherConfigOptions(c)
 	if err != nil {
 		return nil, fmt.Errorf("gathering config options: %w", err)
 	}
 
-	if len(configOptions) != 0 {
-		config, err := nvkind.NewConfig(configOptions...)
-		if err != nil {
-			return nil, fmt.Errorf("new config: %w", err)
-		}
-		clusterOptions = append(clusterOptions, nvkind.WithConfig(config))
+	config, err := nvkind.NewConfig(configOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("new config: %w", err)
 	}
+	clusterOptions = append(clusterOptions, nvkind.WithConfig(config))
 
 	return clusterOptions, nil
 }
@@ -209,5 +215,32 @@ func (f *ClusterCreateFlags) gatherClusterCreateOptions() ([]nvkind.ClusterCreat
 		clusterCreateOptions = append(clusterCreateOptions, nvkind.WithWait(f.Wait))
 	}
 
+	if len(f.Labels.Value()) != 0 {
+		clusterLabels, err := labels.ConvertSelectorToLabelsMap(strings.Join(f.Labels.Value(), ","))
+		if err != nil {
+			return nil, fmt.Errorf("parsing labels: %w", err)
+		}
+		clusterCreateOptions = append(clusterCreateOptions, nvkind.WithLabels(clusterLabels))
+	}
+
 	return clusterCreateOptions, nil
 }
+
+func readConfigValues(path string) ([]byte, error) {
+	if path != "-" {
+		configValues, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading file: %w", err)
+		}
+		return configValues, nil
+	}
+
+	var configValues []byte
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		configValues = append(configValues, scanner.Bytes()...)
+		configValues = append(configValues, '\n')
+	}
+
+	return configValues, nil
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+	"sigs.k8s.io/yaml"
+)
+
+type ClusterDescribeFlags struct {
+	Cluster ClusterFlags
+	Output  string
+}
+
+func BuildClusterDescribeCommand() *cli.Command {
+	flags := ClusterDescribeFlags{}
+
+	cmd := cli.Command{}
+	cmd.Name = "describe"
+	cmd.Usage = "show the config of a cluster and the state of each of its nodes"
+	cmd.Action = func(ctx *cli.Context) error {
+		return runClusterDescribe(ctx, &flags)
+	}
+
+	cmd.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:        "output",
+			Aliases:     []string{"o"},
+			Usage:       "the output format (text, json, or yaml)",
+			Value:       "text",
+			Destination: &flags.Output,
+		},
+	}
+
+	cmd.Flags = append(cmd.Flags, flags.Cluster.flags("the name of the cluster to describe")...)
+
+	return &cmd
+}
+
+func runClusterDescribe(c *cli.Context, f *ClusterDescribeFlags) error {
+	switch f.Output {
+	case "text", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format: %v", f.Output)
+	}
+
+	cluster, err := f.Cluster.getCluster(c.Context)
+	if err != nil {
+		return err
+	}
+
+	description, err := cluster.Describe(c.Context)
+	if err != nil {
+		return fmt.Errorf("describing cluster: %w", err)
+	}
+
+	switch f.Output {
+	case "json":
+		jsonData, err := json.MarshalIndent(description, "", "    ")
+		if err != nil {
+			return fmt.Errorf("marshaling description: %w", err)
+		}
+		fmt.Println(string(jsonData))
+	case "yaml":
+		yamlData, err := yaml.Marshal(description)
+		if err != nil {
+			return fmt.Errorf("marshaling description: %w", err)
+		}
+		fmt.Print(string(yamlData))
+	default:
+		printClusterDescription(description)
+	}
+
+	return nil
+}
+
+func printClusterDescription(d *nvkind.ClusterDescription) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", d.Name)
+	fmt.Fprintf(w, "Kube Context:\t%s\n", d.KubeContext)
+	if d.Created != nil {
+		fmt.Fprintf(w, "Created:\t%s\n", d.Created.Local().Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(w, "Created By:\tnvkind %s\n", d.NvkindVersion)
+	}
+	fmt.Fprintf(w, "Container Toolkit:\t%s\n", describeToolkit(d.ContainerToolkitChannel, d.ContainerToolkitVersion))
+	fmt.Fprintln(w, "Container Runtime:")
+	fmt.Fprintf(w, "  Set As Default:\t%t\n", d.ContainerRuntime.SetAsDefault)
+	fmt.Fprintf(w, "  CDI Enabled:\t%t\n", d.ContainerRuntime.CDIEnabled)
+	fmt.Fprintf(w, "  Annotation Prefixes:\t%s\n", orNone(strings.Join(d.ContainerRuntime.AnnotationPrefixes, ",")))
+	fmt.Fprintf(w, "  Generate CDI Spec:\t%t\n", d.ContainerRuntime.GenerateCDISpec)
+	w.Flush()
+
+	fmt.Println("Nodes:")
+	for _, node := range d.Nodes {
+		fmt.Printf("  %s:\n", node.Name)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "    Role:\t%s\n", node.Role)
+		fmt.Fprintf(w, "    Image:\t%s\n", node.Image)
+		fmt.Fprintf(w, "    Default Runtime:\t%s\n", node.DefaultRuntime)
+		if node.Provisioning != nil {
+			fmt.Fprintf(w, "    Toolkit Version:\t%s\n", orNone(node.ToolkitVersion))
+			fmt.Fprintf(w, "    CDI Hooks Applied:\t%t\n", node.Provisioning.CDIHooksApplied)
+			fmt.Fprintf(w, "    Toolkit Installed:\t%t\n", node.Provisioning.ToolkitInstalled)
+			fmt.Fprintf(w, "    Runtime Configured:\t%t\n", node.Provisioning.RuntimeConfigured)
+			fmt.Fprintf(w, "    /proc/driver/nvidia Patched:\t%s\n", describeProcDriverPatched(node))
+		}
+		w.Flush()
+		if len(node.Devices) == 0 {
+			continue
+		}
+		fmt.Println("    Devices:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "      DEVICE\tHOST INDEX\tUUID\tHOST")
+		for _, device := range node.Devices {
+			var host string
+			switch {
+			case device.Drift != "":
+				host = "changed: " + device.Drift
+			case device.UUID != "":
+				host = "unchanged"
+			}
+			fmt.Fprintf(w, "      %s\t%s\t%s\t%s\n", device.Device, orNone(device.HostIndex), orNone(device.UUID), orNone(host))
+		}
+		w.Flush()
+	}
+
+	fmt.Println("Config:")
+	for _, line := range strings.Split(strings.TrimRight(d.Config, "\n"), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+}
+
+func describeToolkit(channel, version string) string {
+	if version == "" {
+		version = "latest"
+	}
+	if channel == "" {
+		return version
+	}
+	return fmt.Sprintf("%s (%s)", version, channel)
+}
+
+// describeProcDriverPatched shows the current state of the patch, calling out
+// nodes where it was applied during provisioning but has since been lost.
+func describeProcDriverPatched(node nvkind.NodeDescription) string {
+	patched := strconv.FormatBool(node.ProcDriverPatched)
+	if node.Provisioning.ProcDriverPatched && !node.ProcDriverPatched {
+		patched += " (lost since provisioning, run 'nvkind cluster reconcile')"
+	}
+	return patched
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/homedir"
+)
+
+// ClusterFlags are the flags shared by all commands that operate on an
+// existing cluster.
+type ClusterFlags struct {
+	Name       string
+	KubeConfig string
+}
+
+func (f *ClusterFlags) flags(nameUsage string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "name",
+			Usage:       nameUsage,
+			Destination: &f.Name,
+			EnvVars:     []string{"KIND_CLUSTER_NAME"},
+		},
+		&cli.StringFlag{
+			Name:        "kubeconfig",
+			Usage:       "Absolute path to the `KUBECONFIG` file. Either this flag or the KUBECONFIG env variable need to be set if the driver is being run out of cluster.",
+			Destination: &f.KubeConfig,
+			EnvVars:     []string{"KUBECONFIG"},
+		},
+	}
+}
+
+// getCluster returns the existing cluster named by the flags, defaulting to
+// that of the current kubecontext.
+func (f *ClusterFlags) getCluster(ctx context.Context, opts ...nvkind.ClusterOption) (*nvkind.Cluster, error) {
+	if err := f.updateWithDefaults(); err != nil {
+		return nil, fmt.Errorf("updating flags with defaults: %w", err)
+	}
+
+	clusters, err := nvkind.GetClusterNames(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting cluster names: %w", err)
+	}
+
+	if !clusters.Has(f.Name) {
+		return nil, fmt.Errorf("unknown cluster: %v", f.Name)
+	}
+
+	opts = append([]nvkind.ClusterOption{
+		nvkind.WithName(f.Name),
+		nvkind.WithKubeConfig(f.KubeConfig),
+	}, opts...)
+
+	cluster, err := nvkind.NewCluster(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("getting cluster: %w", err)
+	}
+
+	return cluster, nil
+}
+
+// updateWithDefaults fills in the kubeconfig and cluster name, defaulting the
+// cluster name to that of the current kubecontext.
+func (f *ClusterFlags) updateWithDefaults() error {
+	if f.KubeConfig == "" {
+		if home := homedir.HomeDir(); home != "" {
+			f.KubeConfig = home + "/.kube/config"
+		}
+	}
+
+	if f.Name != "" {
+		return nil
+	}
+
+	config, err := clientcmd.LoadFromFile(f.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("loading kubeconfig: %w", err)
+	}
+
+	if config.CurrentContext == "" {
+		return fmt.Errorf("no current kubecontext set")
+	}
+
+	if !strings.HasPrefix(config.CurrentContext, "kind-") {
+		return fmt.Errorf("current kubecontext is not a kind cluster: %v", config.CurrentContext)
+	}
+
+	f.Name = strings.TrimPrefix(config.CurrentContext, "kind-")
+
+	return nil
+}
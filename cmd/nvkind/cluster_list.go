@@ -17,37 +17,123 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"sort"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
 	"github.com/urfave/cli/v2"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
+type ClusterListFlags struct {
+	Output   string
+	Selector string
+	All      bool
+}
+
 func BuildClusterListCommand() *cli.Command {
+	flags := ClusterListFlags{}
+
 	cmd := cli.Command{}
 	cmd.Name = "list"
-	cmd.Usage = "list all kind clusters (whether they have GPUs on them or not)"
-	cmd.Action = runClusterList
+	cmd.Usage = "list all clusters created by nvkind"
+	cmd.Action = func(ctx *cli.Context) error {
+		return runClusterList(ctx, &flags)
+	}
+
+	cmd.Flags = []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "all",
+			Usage:       "also list kind clusters not created by nvkind",
+			Destination: &flags.All,
+		},
+		&cli.StringFlag{
+			Name:        "selector",
+			Aliases:     []string{"l"},
+			Usage:       "only list clusters whose labels match this selector (e.g. team=ml,env!=ci)",
+			Destination: &flags.Selector,
+		},
+		&cli.StringFlag{
+			Name:        "output",
+			Aliases:     []string{"o"},
+			Usage:       "the output format (table or json)",
+			Value:       "table",
+			Destination: &flags.Output,
+		},
+	}
+
 	return &cmd
 }
 
-func runClusterList(c *cli.Context) error {
-	clusters, err := nvkind.GetClusterNames()
+func runClusterList(c *cli.Context, f *ClusterListFlags) error {
+	if f.Output != "table" && f.Output != "json" {
+		return fmt.Errorf("unknown output format: %v", f.Output)
+	}
+
+	selector, err := labels.Parse(f.Selector)
 	if err != nil {
-		return fmt.Errorf("getting cluster names: %w", err)
+		return fmt.Errorf("parsing selector: %w", err)
+	}
+
+	opts := []nvkind.ListClustersOption{
+		nvkind.WithSelector(selector),
+	}
+	if f.All {
+		opts = append(opts, nvkind.WithUnmanagedClusters())
 	}
 
-	clusterList := clusters.UnsortedList()
-	sort.Strings(clusterList)
+	clusters, err := nvkind.ListClusters(c.Context, opts...)
+	if err != nil {
+		return fmt.Errorf("listing clusters: %w", err)
+	}
 
-	if len(clusterList) == 0 {
-		fmt.Println("No kind clusters found.")
+	if f.Output == "json" {
+		if clusters == nil {
+			clusters = []nvkind.ClusterSummary{}
+		}
+		jsonData, err := json.MarshalIndent(clusters, "", "    ")
+		if err != nil {
+			return fmt.Errorf("marshaling clusters: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
 	}
 
-	for _, cluster := range clusterList {
-		fmt.Println(cluster)
+	if len(clusters) == 0 {
+		fmt.Println("No clusters found.")
+		return nil
 	}
 
+	printClusterSummaries(clusters, f.All)
+
 	return nil
 }
+
+func printClusterSummaries(clusters []nvkind.ClusterSummary, withManaged bool) {
+	headers := []string{"NAME", "STATUS", "WORKERS", "GPUS", "CREATED", "LABELS"}
+	if withManaged {
+		headers = append(headers, "NVKIND")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, cluster := range clusters {
+		row := []string{
+			cluster.Name,
+			string(cluster.Status),
+			strconv.Itoa(cluster.Workers),
+			strconv.Itoa(cluster.GPUs),
+			cluster.Created.Local().Format("2006-01-02 15:04:05"),
+			orNone(labels.Set(cluster.Labels).String()),
+		}
+		if withManaged {
+			row = append(row, strconv.FormatBool(cluster.Managed))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
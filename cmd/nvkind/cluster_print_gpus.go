@@ -17,24 +17,32 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
 	"github.com/urfave/cli/v2"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/yaml"
 )
 
 type NodeGPUs struct {
-	Node    string           `json:"node"`
-	GPUInfo []nvkind.GPUInfo `json:"gpus"`
+	Cluster        string           `json:"cluster,omitempty"`
+	Node           string           `json:"node"`
+	ToolkitVersion string           `json:"toolkitVersion,omitempty"`
+	GPUInfo        []nvkind.GPUInfo `json:"gpus"`
 }
 
 type ClusterPrintGPUsFlags struct {
-	Name       string
-	KubeConfig string
+	Cluster ClusterFlags
+	Output  string
+	All     bool
+	Check   bool
 }
 
 func BuildClusterPrintGPUsCommand() *cli.Command {
@@ -48,45 +56,112 @@ func BuildClusterPrintGPUsCommand() *cli.Command {
 	}
 
 	cmd.Flags = []cli.Flag{
-		&cli.StringFlag{
-			Name:        "name",
-			Usage:       "the name of the cluster to print GPUs for",
-			Destination: &flags.Name,
-			EnvVars:     []string{"KIND_CLUSTER_NAME"},
+		&cli.BoolFlag{
+			Name:        "all",
+			Usage:       "print GPUs for all nvkind clusters",
+			Destination: &flags.All,
+		},
+		&cli.BoolFlag{
+			Name:        "check",
+			Usage:       "warn if the GPUs of a cluster have changed on the host since it was created (see cluster check)",
+			Destination: &flags.Check,
 		},
 		&cli.StringFlag{
-			Name:        "kubeconfig",
-			Usage:       "Absolute path to the `KUBECONFIG` file. Either this flag or the KUBECONFIG env variable need to be set if the driver is being run out of cluster.",
-			Destination: &flags.KubeConfig,
-			EnvVars:     []string{"KUBECONFIG"},
+			Name:        "output",
+			Aliases:     []string{"o"},
+			Usage:       "the output format (json, yaml, table, or wide)",
+			Value:       "json",
+			Destination: &flags.Output,
 		},
 	}
 
+	cmd.Flags = append(cmd.Flags, flags.Cluster.flags("the name of the cluster to print GPUs for")...)
+
 	return &cmd
 }
 
 func runClusterPrintGPUs(c *cli.Context, f *ClusterPrintGPUsFlags) error {
-	if err := f.updateFlagsWithDefaults(); err != nil {
-		return fmt.Errorf("updating flags with defaults: %w", err)
+	switch f.Output {
+	case "json", "yaml", "table", "wide":
+	default:
+		return fmt.Errorf("unknown output format: %v", f.Output)
 	}
 
-	clusters, err := nvkind.GetClusterNames()
+	clusters, err := nvkind.GetClusterNames(c.Context)
 	if err != nil {
 		return fmt.Errorf("getting cluster names: %w", err)
 	}
 
-	if !clusters.Has(f.Name) {
-		return fmt.Errorf("unknown cluster: %v", f.Name)
+	var names []string
+	if f.All {
+		names = clusters.UnsortedList()
+		sort.Strings(names)
+	} else {
+		if err := f.Cluster.updateWithDefaults(); err != nil {
+			return fmt.Errorf("updating flags with defaults: %w", err)
+		}
+		if !clusters.Has(f.Cluster.Name) {
+			return fmt.Errorf("unknown cluster: %v", f.Cluster.Name)
+		}
+		names = []string{f.Cluster.Name}
 	}
 
-	cluster, err := nvkind.NewCluster(nvkind.WithName(f.Name))
+	var nodeGPUsList []NodeGPUs
+	for _, name := range names {
+		clusterNodeGPUs, err := getClusterNodeGPUs(c.Context, name, f.Check)
+		if f.All && apierrors.IsNotFound(err) {
+			// Not created by nvkind
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if f.All {
+			for i := range clusterNodeGPUs {
+				clusterNodeGPUs[i].Cluster = name
+			}
+		}
+		nodeGPUsList = append(nodeGPUsList, clusterNodeGPUs...)
+	}
+
+	switch f.Output {
+	case "yaml":
+		yamlData, err := yaml.Marshal(nodeGPUsList)
+		if err != nil {
+			return fmt.Errorf("marshaling GPU info: %w", err)
+		}
+		fmt.Print(string(yamlData))
+	case "table", "wide":
+		printNodeGPUsTable(nodeGPUsList, f.All, f.Output == "wide")
+	default:
+		jsonData, err := json.MarshalIndent(nodeGPUsList, "", "    ")
+		if err != nil {
+			return fmt.Errorf("marshaling GPU info: %w", err)
+		}
+		fmt.Println(string(jsonData))
+	}
+
+	return nil
+}
+
+func getClusterNodeGPUs(ctx context.Context, name string, check bool) ([]NodeGPUs, error) {
+	cluster, err := nvkind.NewCluster(ctx, nvkind.WithName(name))
 	if err != nil {
-		return fmt.Errorf("getting cluster: %w", err)
+		return nil, fmt.Errorf("getting cluster: %w", err)
+	}
+
+	nodes, err := cluster.GetNodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting nodes: %w", err)
+	}
+
+	if check {
+		warnOnChangedGPUs(ctx, cluster)
 	}
 
-	nodes, err := cluster.GetNodes()
+	toolkitVersions, err := cluster.GetContainerToolkitVersions(ctx)
 	if err != nil {
-		return fmt.Errorf("getting nodes: %w", err)
+		return nil, fmt.Errorf("getting container toolkit versions: %w", err)
 	}
 
 	var nodeGPUsList []NodeGPUs
@@ -94,51 +169,66 @@ func runClusterPrintGPUs(c *cli.Context, f *ClusterPrintGPUsFlags) error {
 		if !node.HasGPUs() {
 			continue
 		}
-		gpuInfo, err := node.GetGPUInfo()
+		gpuInfo, err := node.GetGPUInfo(ctx)
 		if err != nil {
-			return fmt.Errorf("getting GPU info on node '%v': %w", node.Name, err)
+			return nil, fmt.Errorf("getting GPU info on node '%v': %w", node.Name, err)
 		}
 		nodeGPUs := NodeGPUs{
-			Node:    node.Name,
-			GPUInfo: gpuInfo,
+			Node:           node.Name,
+			ToolkitVersion: toolkitVersions[node.Name],
+			GPUInfo:        gpuInfo,
 		}
 		nodeGPUsList = append(nodeGPUsList, nodeGPUs)
 	}
 
-	jsonData, err := json.MarshalIndent(nodeGPUsList, "", "    ")
-	if err != nil {
-		return fmt.Errorf("marshaling GPU info: %w", err)
-	}
-	fmt.Println(string(jsonData))
-
-	return nil
+	return nodeGPUsList, nil
 }
 
-func (f *ClusterPrintGPUsFlags) updateFlagsWithDefaults() error {
-	if f.KubeConfig == "" {
-		if home := homedir.HomeDir(); home != "" {
-			f.KubeConfig = home + "/.kube/config"
-		}
+// warnOnChangedGPUs prints a warning if the GPUs of the cluster have changed on
+// the host since it was created.
+func warnOnChangedGPUs(ctx context.Context, cluster *nvkind.Cluster) {
+	report, err := cluster.Check(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to check the GPUs of cluster '%v' against the host: %v\n", cluster.Name, err)
+		return
 	}
-
-	if f.Name != "" {
-		return nil
+	if !report.Passed() {
+		fmt.Fprintf(os.Stderr, "Warning: the GPUs of cluster '%v' have changed since it was created (affected workers: %s); run 'nvkind cluster check --name=%v' for details\n", cluster.Name, strings.Join(report.AffectedNodes(), ", "), cluster.Name)
 	}
+}
 
-	config, err := clientcmd.LoadFromFile(f.KubeConfig)
-	if err != nil {
-		return fmt.Errorf("marshaling GPU info: %w", err)
+func printNodeGPUsTable(nodeGPUsList []NodeGPUs, withCluster, wide bool) {
+	var headers []string
+	if withCluster {
+		headers = append(headers, "CLUSTER")
 	}
-
-	if config.CurrentContext == "" {
-		return fmt.Errorf("no current kubecontext set")
+	headers = append(headers, "NODE", "INDEX", "NAME", "UUID")
+	if wide {
+		headers = append(headers, "MEMORY", "DRIVER", "CUDA", "PCI BUS ID", "MIG", "HOST INDEX", "TOOLKIT")
 	}
 
-	if !strings.HasPrefix(config.CurrentContext, "kind-") {
-		return fmt.Errorf("current kubecontext is not a kind cluster: %v", config.CurrentContext)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, nodeGPUs := range nodeGPUsList {
+		for _, gpu := range nodeGPUs.GPUInfo {
+			var row []string
+			if withCluster {
+				row = append(row, nodeGPUs.Cluster)
+			}
+			row = append(row, nodeGPUs.Node, gpu.Index, gpu.Name, gpu.UUID)
+			if wide {
+				row = append(row,
+					fmt.Sprintf("%dMiB", gpu.MemoryMiB),
+					gpu.DriverVersion,
+					orNone(gpu.CUDAVersion),
+					gpu.PCIBusID,
+					gpu.MigMode,
+					orNone(gpu.HostIndex),
+					orNone(nodeGPUs.ToolkitVersion),
+				)
+			}
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
 	}
-
-	f.Name = strings.TrimPrefix(config.CurrentContext, "kind-")
-
-	return nil
+	w.Flush()
 }
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+)
+
+type ClusterProvisionFlags struct {
+	Cluster     ClusterFlags
+	Resume      bool
+	Parallelism int
+}
+
+func BuildClusterProvisionCommand() *cli.Command {
+	flags := ClusterProvisionFlags{}
+
+	cmd := cli.Command{}
+	cmd.Name = "provision"
+	cmd.Usage = "install and configure the nvidia-container-toolkit on the GPU workers of an existing cluster"
+	cmd.Action = func(ctx *cli.Context) error {
+		return runClusterProvision(ctx, &flags)
+	}
+
+	cmd.Flags = []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "resume",
+			Usage:       "only run the provisioning steps not yet completed on each node",
+			Destination: &flags.Resume,
+		},
+		&cli.IntFlag{
+			Name:        "parallelism",
+			Usage:       "the maximum number of GPU workers to provision at once (default 4)",
+			Destination: &flags.Parallelism,
+			EnvVars:     []string{"KIND_CLUSTER_PARALLELISM"},
+		},
+	}
+
+	cmd.Flags = append(cmd.Flags, flags.Cluster.flags("the name of the cluster to provision")...)
+
+	return &cmd
+}
+
+func runClusterProvision(c *cli.Context, f *ClusterProvisionFlags) error {
+	cluster, err := f.Cluster.getCluster(c.Context, nvkind.WithConfigOptions(outputConfigOptions(c)...))
+	if err != nil {
+		return err
+	}
+
+	var provisionOptions []nvkind.ProvisionOption
+	if f.Resume {
+		provisionOptions = append(provisionOptions, nvkind.WithResume())
+	}
+
+	if f.Parallelism != 0 {
+		provisionOptions = append(provisionOptions, nvkind.WithParallelism(f.Parallelism))
+	}
+
+	if err := cluster.Provision(c.Context, provisionOptions...); err != nil {
+		return fmt.Errorf("provisioning cluster: %w", err)
+	}
+
+	return nil
+}
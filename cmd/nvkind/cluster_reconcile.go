@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+)
+
+type ClusterReconcileFlags struct {
+	Cluster ClusterFlags
+	Nodes   cli.StringSlice
+	Watch   bool
+}
+
+func BuildClusterReconcileCommand() *cli.Command {
+	flags := ClusterReconcileFlags{}
+
+	cmd := cli.Command{}
+	cmd.Name = "reconcile"
+	cmd.Usage = "re-apply the per-node GPU isolation lost when the containers of GPU workers restart"
+	cmd.Action = func(ctx *cli.Context) error {
+		return runClusterReconcile(ctx, &flags)
+	}
+
+	cmd.Flags = []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "node",
+			Usage:       "only reconcile the node with this name (may be repeated)",
+			Destination: &flags.Nodes,
+		},
+		&cli.BoolFlag{
+			Name:        "watch",
+			Usage:       "keep running and reconcile each GPU worker whenever its container is started",
+			Destination: &flags.Watch,
+		},
+	}
+
+	cmd.Flags = append(cmd.Flags, flags.Cluster.flags("the name of the cluster to reconcile")...)
+
+	return &cmd
+}
+
+func runClusterReconcile(c *cli.Context, f *ClusterReconcileFlags) error {
+	if f.Watch && len(f.Nodes.Value()) != 0 {
+		return fmt.Errorf("--node cannot be used with --watch")
+	}
+
+	cluster, err := f.Cluster.getCluster(c.Context, nvkind.WithConfigOptions(outputConfigOptions(c)...))
+	if err != nil {
+		return err
+	}
+
+	if f.Watch {
+		// Interrupting the watch is the expected way to stop it
+		err := cluster.Watch(c.Context)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return fmt.Errorf("watching cluster: %w", err)
+		}
+		return nil
+	}
+
+	var reconcileOptions []nvkind.ReconcileOption
+	if len(f.Nodes.Value()) != 0 {
+		reconcileOptions = append(reconcileOptions, nvkind.WithReconcileNodes(f.Nodes.Value()...))
+	}
+
+	if err := cluster.Reconcile(c.Context, reconcileOptions...); err != nil {
+		return fmt.Errorf("reconciling cluster: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+)
+
+type ClusterVerifyFlags struct {
+	Cluster   ClusterFlags
+	Image     string
+	Namespace string
+	Timeout   time.Duration
+	Output    string
+}
+
+func BuildClusterVerifyCommand() *cli.Command {
+	flags := ClusterVerifyFlags{}
+
+	cmd := cli.Command{}
+	cmd.Name = "verify"
+	cmd.Usage = "verify that each GPU worker of a cluster exposes exactly the GPUs assigned to it"
+	cmd.Action = func(ctx *cli.Context) error {
+		return runClusterVerify(ctx, &flags)
+	}
+
+	cmd.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:        "image",
+			Usage:       "the image to run nvidia-smi in on each GPU worker",
+			Value:       "ubuntu:22.04",
+			Destination: &flags.Image,
+		},
+		&cli.StringFlag{
+			Name:        "namespace",
+			Usage:       "the namespace to run the verification pods in",
+			Value:       "default",
+			Destination: &flags.Namespace,
+		},
+		&cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "how long to wait for each verification pod to complete",
+			Value:       5 * time.Minute,
+			Destination: &flags.Timeout,
+		},
+		&cli.StringFlag{
+			Name:        "output",
+			Aliases:     []string{"o"},
+			Usage:       "the format of the report (text or json)",
+			Value:       "text",
+			Destination: &flags.Output,
+		},
+	}
+
+	cmd.Flags = append(cmd.Flags, flags.Cluster.flags("the name of the cluster to verify")...)
+
+	return &cmd
+}
+
+func runClusterVerify(c *cli.Context, f *ClusterVerifyFlags) error {
+	if f.Output != "text" && f.Output != "json" {
+		return fmt.Errorf("unknown output format: %v", f.Output)
+	}
+
+	cluster, err := f.Cluster.getCluster(c.Context, nvkind.WithConfigOptions(outputConfigOptions(c)...))
+	if err != nil {
+		return err
+	}
+
+	report, err := cluster.Verify(c.Context,
+		nvkind.WithVerifyImage(f.Image),
+		nvkind.WithVerifyNamespace(f.Namespace),
+		nvkind.WithVerifyTimeout(f.Timeout),
+	)
+	if err != nil {
+		return fmt.Errorf("verifying cluster: %w", err)
+	}
+
+	switch f.Output {
+	case "json":
+		jsonData, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return fmt.Errorf("marshaling report: %w", err)
+		}
+		fmt.Println(string(jsonData))
+	default:
+		printVerifyReport(report)
+	}
+
+	if !report.Passed() {
+		return fmt.Errorf("verification of cluster '%v' failed", f.Cluster.Name)
+	}
+
+	return nil
+}
+
+func printVerifyReport(report *nvkind.VerifyReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tCHECK\tRESULT\tMESSAGE")
+	for _, node := range report.Nodes {
+		for _, check := range node.Checks {
+			result := passOrFail(check.Passed)
+			if check.Skipped {
+				result = "SKIP"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", node.Node, check.Name, result, check.Message)
+		}
+	}
+	w.Flush()
+
+	fmt.Println(passOrFail(report.Passed()))
+}
+
+func passOrFail(passed bool) string {
+	if passed {
+		return "PASS"
+	}
+	return "FAIL"
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+)
+
+// ConfigFlags are the flags shared by all commands that generate the config a
+// cluster is created with.
+type ConfigFlags struct {
+	Image           string
+	ConfigTemplate  string
+	ConfigValues    string
+	AllowSharedGPUs bool
+	ToolkitChannel  string
+	ToolkitVersion  string
+	ToolkitPackages string
+	ToolkitMirror   string
+	Runtime         ContainerRuntimeFlags
+}
+
+func (f *ConfigFlags) flags() []cli.Flag {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:        "image",
+			Usage:       "node docker image to use for booting the cluster",
+			Destination: &f.Image,
+			EnvVars:     []string{"KIND_CLUSTER_IMAGE"},
+		},
+		&cli.StringFlag{
+			Name:        "config-template",
+			Usage:       "the path to a custom kind config template",
+			Destination: &f.ConfigTemplate,
+			EnvVars:     []string{"KIND_CLUSTER_CONFIG_TEMPLATE"},
+		},
+		&cli.StringFlag{
+			Name:        "config-values",
+			Usage:       "the path to a values file to fill in the variables from a kind config template",
+			Destination: &f.ConfigValues,
+			EnvVars:     []string{"KIND_CLUSTER_CONFIG_VALUES"},
+		},
+		&cli.BoolFlag{
+			Name:        "allow-shared-gpus",
+			Usage:       "allow the same GPU to be assigned to more than one node",
+			Destination: &f.AllowSharedGPUs,
+			EnvVars:     []string{"KIND_CLUSTER_ALLOW_SHARED_GPUS"},
+		},
+		&cli.StringFlag{
+			Name:        "toolkit-channel",
+			Usage:       "the release channel to install the nvidia-container-toolkit from (stable or experimental)",
+			Destination: &f.ToolkitChannel,
+			EnvVars:     []string{"KIND_CLUSTER_TOOLKIT_CHANNEL"},
+		},
+		&cli.StringFlag{
+			Name:        "toolkit-version",
+			Usage:       "the exact version of the nvidia-container-toolkit to install (e.g. 1.15.0-1)",
+			Destination: &f.ToolkitVersion,
+			EnvVars:     []string{"KIND_CLUSTER_TOOLKIT_VERSION"},
+		},
+		&cli.StringFlag{
+			Name:        "toolkit-packages",
+			Usage:       "the path to a directory of .deb packages to install the nvidia-container-toolkit from (no network access required)",
+			Destination: &f.ToolkitPackages,
+			EnvVars:     []string{"KIND_CLUSTER_TOOLKIT_PACKAGES"},
+		},
+		&cli.StringFlag{
+			Name:        "toolkit-apt-mirror",
+			Usage:       "the path to a flat apt repository to install the nvidia-container-toolkit from (no network access required)",
+			Destination: &f.ToolkitMirror,
+			EnvVars:     []string{"KIND_CLUSTER_TOOLKIT_APT_MIRROR"},
+		},
+	}
+
+	return append(flags, f.Runtime.flags()...)
+}
+
+func (f *ConfigFlags) gatherConfigOptions(c *cli.Context) ([]nvkind.ConfigOption, error) {
+	configOptions := outputConfigOptions(c)
+
+	if f.Image != "" {
+		configOptions = append(configOptions, nvkind.WithImage(f.Image))
+	}
+
+	if f.ConfigTemplate != "" {
+		configOptions = append(configOptions, nvkind.WithConfigTemplate(f.ConfigTemplate))
+	}
+
+	if f.ConfigValues != "" {
+		configValues, err := readConfigValues(f.ConfigValues)
+		if err != nil {
+			return nil, fmt.Errorf("reading config values: %w", err)
+		}
+		configOptions = append(configOptions, nvkind.WithConfigValues(configValues))
+	}
+
+	if f.AllowSharedGPUs {
+		configOptions = append(configOptions, nvkind.WithAllowSharedGPUs())
+	}
+
+	if f.ToolkitChannel != "" {
+		configOptions = append(configOptions, nvkind.WithContainerToolkitChannel(f.ToolkitChannel))
+	}
+
+	if f.ToolkitVersion != "" {
+		configOptions = append(configOptions, nvkind.WithContainerToolkitVersion(f.ToolkitVersion))
+	}
+
+	if f.ToolkitPackages != "" {
+		configOptions = append(configOptions, nvkind.WithContainerToolkitPackages(f.ToolkitPackages))
+	}
+
+	if f.ToolkitMirror != "" {
+		configOptions = append(configOptions, nvkind.WithContainerToolkitAptMirror(f.ToolkitMirror))
+	}
+
+	if option, exists := f.Runtime.configOption(); exists {
+		configOptions = append(configOptions, option)
+	}
+
+	return configOptions, nil
+}
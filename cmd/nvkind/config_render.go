@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v2"
+)
+
+type ConfigRenderFlags struct {
+	Name   string
+	Config ConfigFlags
+}
+
+func BuildConfigRenderCommand() *cli.Command {
+	flags := ConfigRenderFlags{}
+
+	cmd := cli.Command{}
+	cmd.Name = "render"
+	cmd.Usage = "print the kind config a cluster would be created with, without creating it"
+	cmd.Action = func(ctx *cli.Context) error {
+		return runConfigRender(ctx, &flags)
+	}
+
+	cmd.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:        "name",
+			Usage:       "the name of the cluster to render the config for (default nvkind-<random>)",
+			Destination: &flags.Name,
+			EnvVars:     []string{"KIND_CLUSTER_NAME"},
+		},
+	}
+
+	cmd.Flags = append(cmd.Flags, flags.Config.flags()...)
+
+	return &cmd
+}
+
+func runConfigRender(c *cli.Context, f *ConfigRenderFlags) error {
+	configOptions, err := f.Config.gatherConfigOptions(c)
+	if err != nil {
+		return fmt.Errorf("gathering config options: %w", err)
+	}
+
+	config, err := nvkind.NewConfig(configOptions...)
+	if err != nil {
+		return fmt.Errorf("new config: %w", err)
+	}
+	if f.Name != "" {
+		config.Name = f.Name
+	}
+
+	configBytes, err := yaml.Marshal(config.Cluster)
+	if err != nil {
+		return fmt.Errorf("marshaling YAML: %w", err)
+	}
+	fmt.Print(string(configBytes))
+
+	assignments, err := config.GetDeviceAssignments()
+	if err != nil {
+		return fmt.Errorf("getting device assignments: %w", err)
+	}
+
+	// Print the summary to stderr so the config can be piped on its own
+	if len(assignments) != 0 {
+		fmt.Fprintln(os.Stderr)
+		w := tabwriter.NewWriter(os.Stderr, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NODE\tDEVICE\tHOST INDEX\tUUID\tNAME")
+		for _, a := range assignments {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", a.Node, a.Device, orNone(a.HostIndex), orNone(a.UUID), orNone(a.Name))
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("flushing output: %w", err)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("validating config: %w", err)
+	}
+
+	return nil
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+)
+
+// ContainerRuntimeFlags are the flags shared by all commands that configure
+// containerd to use the nvidia-container-runtime.
+type ContainerRuntimeFlags struct {
+	RuntimeClassOnly      bool
+	CDIEnabled            bool
+	CDIAnnotationPrefixes cli.StringSlice
+	GenerateCDISpec       bool
+}
+
+func (f *ContainerRuntimeFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "runtime-class-only",
+			Usage:       "do not set nvidia as the default runtime of containerd; make it available through the nvidia RuntimeClass only",
+			Destination: &f.RuntimeClassOnly,
+			EnvVars:     []string{"KIND_CLUSTER_RUNTIME_CLASS_ONLY"},
+		},
+		&cli.BoolFlag{
+			Name:        "cdi-enabled",
+			Usage:       "enable CDI support in containerd",
+			Destination: &f.CDIEnabled,
+			EnvVars:     []string{"KIND_CLUSTER_CDI_ENABLED"},
+		},
+		&cli.StringSliceFlag{
+			Name:        "cdi-annotation-prefix",
+			Usage:       "an annotation prefix the nvidia-container-runtime looks for CDI device requests under (may be repeated)",
+			Destination: &f.CDIAnnotationPrefixes,
+			EnvVars:     []string{"KIND_CLUSTER_CDI_ANNOTATION_PREFIXES"},
+		},
+		&cli.BoolFlag{
+			Name:        "generate-cdi-spec",
+			Usage:       "generate a CDI spec for the GPUs of each node with nvidia-ctk cdi generate",
+			Destination: &f.GenerateCDISpec,
+			EnvVars:     []string{"KIND_CLUSTER_GENERATE_CDI_SPEC"},
+		},
+	}
+}
+
+// configOption returns an option overriding the container runtime config of
+// the values file if any of the flags are set.
+func (f *ContainerRuntimeFlags) configOption() (nvkind.ConfigOption, bool) {
+	prefixes := f.CDIAnnotationPrefixes.Value()
+	if !f.RuntimeClassOnly && !f.CDIEnabled && len(prefixes) == 0 && !f.GenerateCDISpec {
+		return nil, false
+	}
+
+	config := nvkind.ContainerRuntimeConfig{
+		SetAsDefault:       !f.RuntimeClassOnly,
+		CDIEnabled:         f.CDIEnabled,
+		AnnotationPrefixes: prefixes,
+		GenerateCDISpec:    f.GenerateCDISpec,
+	}
+
+	return nvkind.WithContainerRuntimeConfig(config), true
+}
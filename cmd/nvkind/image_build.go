@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+)
+
+type ImageBuildFlags struct {
+	BaseImage       string
+	Tag             string
+	ToolkitChannel  string
+	ToolkitVersion  string
+	ToolkitPackages string
+	ToolkitMirror   string
+	Runtime         ContainerRuntimeFlags
+}
+
+func BuildImageBuildCommand() *cli.Command {
+	flags := ImageBuildFlags{}
+
+	cmd := cli.Command{}
+	cmd.Name = "build"
+	cmd.Usage = "build a kind node image with the nvidia-container-toolkit preinstalled"
+	cmd.Action = func(ctx *cli.Context) error {
+		return runImageBuild(ctx, &flags)
+	}
+
+	cmd.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:        "base-image",
+			Usage:       "the kind node image to build on top of (e.g. kindest/node:v1.29.2)",
+			Destination: &flags.BaseImage,
+			Required:    true,
+		},
+		&cli.StringFlag{
+			Name:        "tag",
+			Usage:       "the tag to give the resulting image",
+			Destination: &flags.Tag,
+			Required:    true,
+		},
+		&cli.StringFlag{
+			Name:        "toolkit-channel",
+			Usage:       "the release channel to install the nvidia-container-toolkit from (stable or experimental)",
+			Destination: &flags.ToolkitChannel,
+			EnvVars:     []string{"KIND_CLUSTER_TOOLKIT_CHANNEL"},
+		},
+		&cli.StringFlag{
+			Name:        "toolkit-version",
+			Usage:       "the exact version of the nvidia-container-toolkit to install (e.g. 1.15.0-1)",
+			Destination: &flags.ToolkitVersion,
+			EnvVars:     []string{"KIND_CLUSTER_TOOLKIT_VERSION"},
+		},
+		&cli.StringFlag{
+			Name:        "toolkit-packages",
+			Usage:       "the path to a directory of .deb packages to install the nvidia-container-toolkit from (no network access required)",
+			Destination: &flags.ToolkitPackages,
+			EnvVars:     []string{"KIND_CLUSTER_TOOLKIT_PACKAGES"},
+		},
+		&cli.StringFlag{
+			Name:        "toolkit-apt-mirror",
+			Usage:       "the path to a flat apt repository to install the nvidia-container-toolkit from (no network access required)",
+			Destination: &flags.ToolkitMirror,
+			EnvVars:     []string{"KIND_CLUSTER_TOOLKIT_APT_MIRROR"},
+		},
+	}
+
+	cmd.Flags = append(cmd.Flags, flags.Runtime.flags()...)
+
+	return &cmd
+}
+
+func runImageBuild(c *cli.Context, f *ImageBuildFlags) error {
+	configOptions := outputConfigOptions(c)
+
+	if f.ToolkitChannel != "" {
+		configOptions = append(configOptions, nvkind.WithContainerToolkitChannel(f.ToolkitChannel))
+	}
+
+	if f.ToolkitVersion != "" {
+		configOptions = append(configOptions, nvkind.WithContainerToolkitVersion(f.ToolkitVersion))
+	}
+
+	if f.ToolkitPackages != "" {
+		configOptions = append(configOptions, nvkind.WithContainerToolkitPackages(f.ToolkitPackages))
+	}
+
+	if f.ToolkitMirror != "" {
+		configOptions = append(configOptions, nvkind.WithContainerToolkitAptMirror(f.ToolkitMirror))
+	}
+
+	if option, exists := f.Runtime.configOption(); exists {
+		configOptions = append(configOptions, option)
+	}
+
+	image, err := nvkind.NewNodeImage(
+		nvkind.WithBaseImage(f.BaseImage),
+		nvkind.WithTag(f.Tag),
+		nvkind.WithNodeImageConfigOptions(configOptions...),
+	)
+	if err != nil {
+		return fmt.Errorf("new node image: %w", err)
+	}
+
+	if err := image.Build(c.Context); err != nil {
+		return fmt.Errorf("building image: %w", err)
+	}
+
+	return nil
+}
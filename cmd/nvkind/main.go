@@ -17,8 +17,12 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
 	"github.com/urfave/cli/v2"
 	"k8s.io/klog/v2"
 )
@@ -27,6 +31,8 @@ import (
 var Version = "devel"
 
 func main() {
+	nvkind.Version = Version
+
 	// Create the top-level CLI
 	c := cli.NewApp()
 	c.Name = "nvkind"
@@ -34,13 +40,35 @@ func main() {
 	c.Version = Version
 	c.EnableBashCompletion = true
 
+	// Free up -v for the verbosity
+	cli.VersionFlag = &cli.BoolFlag{
+		Name:  "version",
+		Usage: "print the version",
+	}
+
+	c.Flags = []cli.Flag{
+		&cli.IntFlag{
+			Name:    "verbosity",
+			Aliases: []string{"v"},
+			Usage:   "the verbosity of the output (0: a status line per step, 1: the output of the commands run, 2: detailed logs)",
+			EnvVars: []string{"NVKIND_VERBOSITY"},
+		},
+	}
+
 	// Register the subcommands with the top-level CLI
 	c.Commands = []*cli.Command{
+		BuildAddonCommand(),
 		BuildClusterCommand(),
+		BuildConfigCommand(),
+		BuildImageCommand(),
 	}
 
+	// Cancel any in-flight operations on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Run the CLI
-	err := c.Run(os.Args)
+	err := c.RunContext(ctx, os.Args)
 	if err != nil {
 		klog.Fatalf("Error: %v", err)
 	}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klueska/kind-with-gpus-examples/pkg/nvkind"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+// outputConfigOptions returns the options controlling what is printed while
+// running long operations, depending on the verbosity set with -v.
+func outputConfigOptions(c *cli.Context) []nvkind.ConfigOption {
+	verbosity := c.Int("verbosity")
+
+	printer := &progressPrinter{
+		w: os.Stderr,
+	}
+	options := []nvkind.ConfigOption{
+		nvkind.WithProgressHandler(printer.handle),
+	}
+
+	if verbosity < 1 {
+		printer.output = &recordedOutput{}
+		options = append(options, nvkind.WithOutput(printer.output, printer.output))
+	}
+
+	if verbosity >= 2 {
+		options = append(options, nvkind.WithLogger(klog.NewKlogr()))
+	}
+
+	return options
+}
+
+// progressPrinter prints a kind-style status line for each progress event.
+type progressPrinter struct {
+	sync.Mutex
+	w io.Writer
+	// output is the output of the commands run, if it is not printed
+	// as it is written.
+	output *recordedOutput
+}
+
+func (p *progressPrinter) handle(event nvkind.ProgressEvent) {
+	p.Lock()
+	defer p.Unlock()
+
+	step := event.Step
+	if event.Node != "" {
+		step = fmt.Sprintf("%s [%s]", step, event.Node)
+	}
+
+	switch event.Type {
+	case nvkind.StepStarted:
+		if p.output != nil && event.Node == "" {
+			p.output.reset()
+		}
+		fmt.Fprintf(p.w, " • %s ...\n", step)
+	case nvkind.StepFinished:
+		fmt.Fprintf(p.w, " ✓ %s (%s)\n", step, event.Duration.Round(100*time.Millisecond))
+	case nvkind.StepFailed:
+		fmt.Fprintf(p.w, " ✗ %s (%s)\n", step, event.Duration.Round(100*time.Millisecond))
+		if p.output != nil {
+			p.output.print(p.w, event.Node)
+		}
+	}
+}
+
+// recordedOutput records the output of the commands run since the last step
+// on the cluster as a whole started, so that it can be printed if a step
+// fails.
+type recordedOutput struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *recordedOutput) Write(b []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+	return o.buf.Write(b)
+}
+
+func (o *recordedOutput) reset() {
+	o.Lock()
+	defer o.Unlock()
+	o.buf.Reset()
+}
+
+// print writes the recorded output to w. If node is set, only the lines
+// prefixed with its name are written.
+func (o *recordedOutput) print(w io.Writer, node string) {
+	o.Lock()
+	defer o.Unlock()
+
+	prefix := fmt.Sprintf("[%s] ", node)
+	for _, line := range strings.SplitAfter(o.buf.String(), "\n") {
+		if line == "" || (node != "" && !strings.HasPrefix(line, prefix)) {
+			continue
+		}
+		fmt.Fprintf(w, "   %s", line)
+		if !strings.HasSuffix(line, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+}
@@ -5,6 +5,7 @@ go 1.22.1
 require (
 	github.com/Masterminds/sprig/v3 v3.2.3
 	github.com/NVIDIA/go-nvlib v0.2.0
+	github.com/go-logr/logr v1.3.0
 	github.com/urfave/cli/v2 v2.27.1
 	gopkg.in/yaml.v2 v2.4.0
 	k8s.io/api v0.29.3
@@ -12,6 +13,7 @@ require (
 	k8s.io/client-go v0.29.3
 	k8s.io/klog/v2 v2.110.1
 	sigs.k8s.io/kind v0.22.0
+	sigs.k8s.io/yaml v1.3.0
 )
 
 require (
@@ -21,7 +23,6 @@ require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/emicklei/go-restful/v3 v3.11.0 // indirect
-	github.com/go-logr/logr v1.3.0 // indirect
 	github.com/go-openapi/jsonpointer v0.19.6 // indirect
 	github.com/go-openapi/jsonreference v0.20.2 // indirect
 	github.com/go-openapi/swag v0.22.3 // indirect
@@ -61,5 +62,4 @@ require (
 	k8s.io/utils v0.0.0-20230726121419-3b25d923346b // indirect
 	sigs.k8s.io/json v0.0.0-20221116044647-bc3834ca7abd // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.4.1 // indirect
-	sigs.k8s.io/yaml v1.3.0 // indirect
 )
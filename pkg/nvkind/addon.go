@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	nvidiaHelmRepo         = "https://helm.ngc.nvidia.com/nvidia"
+	nvidiaDevicePluginRepo = "https://nvidia.github.io/k8s-device-plugin"
+)
+
+var builtinAddons = map[string]Addon{
+	"device-plugin": {
+		ReleaseName: "nvidia-device-plugin",
+		Namespace:   "nvidia",
+		Repo:        nvidiaDevicePluginRepo,
+		Chart:       "nvidia-device-plugin",
+		derivedValues: func(runtime ContainerRuntimeConfig) []string {
+			var values []string
+			if runtime.CDIEnabled {
+				values = append(values, "deviceListStrategy=cdi-cri")
+			}
+			if !runtime.SetAsDefault {
+				values = append(values, "runtimeClassName="+nvidiaRuntimeName)
+			}
+			return values
+		},
+	},
+	"gpu-operator": {
+		ReleaseName: "gpu-operator",
+		Namespace:   "gpu-operator",
+		Repo:        nvidiaHelmRepo,
+		Chart:       "gpu-operator",
+		derivedValues: func(runtime ContainerRuntimeConfig) []string {
+			// The driver is shared with the host and nvkind installs the
+			// toolkit itself.
+			values := []string{
+				"driver.enabled=false",
+				"toolkit.enabled=false",
+			}
+			if runtime.CDIEnabled {
+				values = append(values, "cdi.enabled=true")
+			}
+			return values
+		},
+	},
+	"dra-driver": {
+		ReleaseName: "nvidia-dra-driver-gpu",
+		Namespace:   "nvidia-dra-driver-gpu",
+		Repo:        nvidiaHelmRepo,
+		Chart:       "nvidia-dra-driver-gpu",
+		derivedValues: func(runtime ContainerRuntimeConfig) []string {
+			return []string{
+				"nvidiaDriverRoot=/",
+			}
+		},
+	},
+}
+
+// AddonNames returns the names of all addons known to nvkind.
+func AddonNames() []string {
+	var names []string
+	for name := range builtinAddons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewAddon returns the addon with the given name.
+func NewAddon(name string, opts ...AddonOption) (*Addon, error) {
+	o := AddonOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	builtin, exists := builtinAddons[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown addon %q (must be one of %s)", name, strings.Join(AddonNames(), ", "))
+	}
+
+	addon := builtin
+	addon.Name = name
+	addon.source = o.source
+	addon.values = o.values
+
+	if addon.source != "" && addon.isManifest() && len(addon.values) != 0 {
+		return nil, fmt.Errorf("values cannot be set on addon %q installed from manifests", name)
+	}
+
+	return &addon, nil
+}
+
+// InstallAddon installs (or upgrades) the addon on the cluster. Helm charts
+// are installed with helm and manifests with kubectl, both of which must be
+// available on the host.
+func (c *Cluster) InstallAddon(ctx context.Context, addon *Addon) error {
+	var command []string
+	if addon.source != "" && addon.isManifest() {
+		command = []string{
+			"kubectl", "apply",
+			"--kubeconfig", c.kubeconfig,
+			"--context", "kind-" + c.Name,
+			"--filename", addon.source,
+		}
+	} else {
+		command = []string{
+			"helm", "upgrade", "--install",
+			"--kubeconfig", c.kubeconfig,
+			"--kube-context", "kind-" + c.Name,
+			"--namespace", addon.Namespace,
+			"--create-namespace",
+		}
+		chart := addon.source
+		if chart == "" {
+			chart = addon.Chart
+			command = append(command, "--repo", addon.Repo)
+		}
+		for _, value := range addon.getValues(c.runtime) {
+			command = append(command, "--set", value)
+		}
+		command = append(command, addon.ReleaseName, chart)
+	}
+
+	err := c.progress.runStep("", fmt.Sprintf("Installing addon %s", addon.Name), func() error {
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Stdout = c.stdout
+		cmd.Stderr = c.stderr
+		return cmd.Run()
+	})
+	if err != nil {
+		return fmt.Errorf("executing command: %w", err)
+	}
+
+	return nil
+}
+
+// getValues returns the helm values to install the addon with. Values set
+// explicitly come last so they override those derived from the cluster.
+func (a *Addon) getValues(runtime ContainerRuntimeConfig) []string {
+	var values []string
+	if a.derivedValues != nil {
+		values = append(values, a.derivedValues(runtime)...)
+	}
+	return append(values, a.values...)
+}
+
+// isManifest returns true if the source of the addon is a manifest file or a
+// directory of manifests rather than a helm chart.
+func (a *Addon) isManifest() bool {
+	if info, err := os.Stat(a.source); err == nil && info.IsDir() {
+		_, err := os.Stat(filepath.Join(a.source, "Chart.yaml"))
+		return err != nil
+	}
+	switch filepath.Ext(a.source) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
@@ -23,6 +23,8 @@ import (
 	"time"
 
 	"github.com/NVIDIA/go-nvlib/pkg/nvml"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/labels"
 	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
 )
 
@@ -34,32 +36,286 @@ var defaultConfigValues []byte
 
 type Config struct {
 	*kind.Cluster
-	nvml   nvml.Interface
-	stdout io.Writer
-	stderr io.Writer
+	nvml            nvml.Interface
+	stdout          io.Writer
+	stderr          io.Writer
+	progress        progressReporter
+	allowSharedGPUs bool
+	toolkit         toolkitConfig
+	runtime         ContainerRuntimeConfig
+	cdiDevices      cdiDeviceRequests
+	configTemplate  []byte
+	configValues    []byte
 }
 
 type Cluster struct {
+	Name            string
+	config          *kind.Cluster
+	kubeconfig      string
+	nvml            nvml.Interface
+	stdout          io.Writer
+	stderr          io.Writer
+	progress        progressReporter
+	allowSharedGPUs bool
+	toolkit         toolkitConfig
+	runtime         ContainerRuntimeConfig
+	cdiDevices      cdiDeviceRequests
+	configTemplate  []byte
+	configValues    []byte
+}
+
+type Node struct {
 	Name       string
-	config     *kind.Cluster
-	kubeconfig string
+	config     *kind.Node
 	nvml       nvml.Interface
 	stdout     io.Writer
 	stderr     io.Writer
+	progress   progressReporter
+	toolkit    toolkitConfig
+	runtime    ContainerRuntimeConfig
+	cdiDevices []string
 }
 
-type Node struct {
-	Name   string
-	config *kind.Node
-	nvml   nvml.Interface
-	stdout io.Writer
-	stderr io.Writer
+// ContainerRuntimeConfig describes how containerd is configured to use the
+// nvidia-container-runtime on each GPU worker.
+type ContainerRuntimeConfig struct {
+	// SetAsDefault makes nvidia the default runtime of containerd. If
+	// false, it is only available through the nvidia RuntimeClass.
+	SetAsDefault bool `yaml:"setAsDefault" json:"setAsDefault"`
+	// CDIEnabled enables CDI support in containerd.
+	CDIEnabled bool `yaml:"cdiEnabled" json:"cdiEnabled"`
+	// AnnotationPrefixes sets the annotation prefixes the
+	// nvidia-container-runtime looks for CDI device requests under.
+	AnnotationPrefixes []string `yaml:"annotationPrefixes,omitempty" json:"annotationPrefixes,omitempty"`
+	// GenerateCDISpec generates a CDI spec for the GPUs of each node.
+	GenerateCDISpec bool `yaml:"generateCDISpec" json:"generateCDISpec"`
+}
+
+type NodeImage struct {
+	BaseImage string
+	Tag       string
+	toolkit   toolkitConfig
+	runtime   ContainerRuntimeConfig
+	stdout    io.Writer
+	stderr    io.Writer
+	progress  progressReporter
+}
+
+// toolkitConfig holds the settings used to install the
+// nvidia-container-toolkit on a node.
+type toolkitConfig struct {
+	channel      string
+	version      string
+	packagesDir  string
+	aptMirrorDir string
+}
+
+type Addon struct {
+	Name        string
+	ReleaseName string
+	Namespace   string
+	Repo        string
+	Chart       string
+	source      string
+	values      []string
+	// derivedValues returns the helm values of the addon that depend on how
+	// the cluster is configured.
+	derivedValues func(ContainerRuntimeConfig) []string
+}
+
+type ProgressEventType string
+
+const (
+	StepStarted  ProgressEventType = "StepStarted"
+	StepFinished ProgressEventType = "StepFinished"
+	StepFailed   ProgressEventType = "StepFailed"
+)
+
+// ProgressEvent reports the progress of a step of a long running operation,
+// such as creating or provisioning a cluster.
+type ProgressEvent struct {
+	Type ProgressEventType
+	Step string
+	// Node is the node the step runs on, or empty for steps on the cluster
+	// as a whole.
+	Node string
+	// Duration is how long the step took, once finished or failed.
+	Duration time.Duration
+	// Err is the error the step failed with.
+	Err error
+}
+
+// ProgressHandler is called with each progress event. It may be called
+// concurrently for steps running on different nodes.
+type ProgressHandler func(ProgressEvent)
+
+// NodeProvisioningState records which provisioning steps have completed on a
+// GPU worker of a cluster.
+type NodeProvisioningState struct {
+	CDIHooksApplied   bool `yaml:"cdiHooksApplied" json:"cdiHooksApplied"`
+	ToolkitInstalled  bool `yaml:"toolkitInstalled" json:"toolkitInstalled"`
+	RuntimeConfigured bool `yaml:"runtimeConfigured" json:"runtimeConfigured"`
+	ProcDriverPatched bool `yaml:"procDriverPatched" json:"procDriverPatched"`
+}
+
+// VerifyReport is the result of verifying the GPUs of each GPU worker of a
+// cluster with Cluster.Verify.
+type VerifyReport struct {
+	Cluster string             `json:"cluster"`
+	Nodes   []NodeVerifyResult `json:"nodes"`
+}
+
+type NodeVerifyResult struct {
+	Node   string        `json:"node"`
+	Checks []VerifyCheck `json:"checks"`
+}
+
+type VerifyCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	// Skipped is true for checks that could not be run, which do not fail
+	// the verification.
+	Skipped bool   `json:"skipped,omitempty"`
+	Message string `json:"message"`
+}
+
+// ClusterDescription is a summary of how a cluster was configured and the
+// current state of each of its nodes, as returned by Cluster.Describe.
+type ClusterDescription struct {
+	Name        string `json:"name"`
+	KubeContext string `json:"kubeContext"`
+	// NvkindVersion and Created are only known for clusters created by
+	// nvkind versions that recorded them.
+	NvkindVersion           string                 `json:"nvkindVersion,omitempty"`
+	Created                 *time.Time             `json:"created,omitempty"`
+	ContainerRuntime        ContainerRuntimeConfig `json:"containerRuntime"`
+	ContainerToolkitChannel string                 `json:"containerToolkitChannel,omitempty"`
+	ContainerToolkitVersion string                 `json:"containerToolkitVersion,omitempty"`
+	Nodes                   []NodeDescription      `json:"nodes"`
+	// Config is the kind config the cluster was created with, as stored in
+	// the cluster.
+	Config string `json:"config"`
+}
+
+type NodeDescription struct {
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	Image string `json:"image"`
+	// Devices are only known for clusters created by nvkind versions that
+	// recorded them.
+	Devices        []DeviceDescription `json:"devices,omitempty"`
+	ToolkitVersion string              `json:"toolkitVersion,omitempty"`
+	// DefaultRuntime is the default runtime of containerd on the node.
+	DefaultRuntime string                 `json:"defaultRuntime"`
+	Provisioning   *NodeProvisioningState `json:"provisioning,omitempty"`
+	// ProcDriverPatched reports whether /proc/driver/nvidia is currently
+	// patched on the node, as opposed to whether it was recorded as patched
+	// during provisioning.
+	ProcDriverPatched bool `json:"procDriverPatched"`
+}
+
+// DeviceDescription is a device of a node as recorded when its cluster was
+// created.
+type DeviceDescription struct {
+	DeviceAssignment
+	// Drift describes how the device no longer matches the host, if it
+	// does not.
+	Drift string `json:"drift,omitempty"`
+}
+
+// CheckReport is the result of comparing the host GPUs each worker of a
+// cluster was given when it was created to those its devices refer to now, as
+// returned by Cluster.Check.
+type CheckReport struct {
+	Cluster string `json:"cluster"`
+	// Recorded is false for clusters created by versions of nvkind that did
+	// not record the host GPUs of each worker, which cannot be checked.
+	Recorded bool          `json:"recorded"`
+	Drift    []DeviceDrift `json:"drift,omitempty"`
+}
+
+// DeviceDrift is a device of a worker that no longer refers to the host GPU
+// it did when the cluster was created.
+type DeviceDrift struct {
+	Node              string `json:"node"`
+	Device            string `json:"device"`
+	RecordedHostIndex string `json:"recordedHostIndex,omitempty"`
+	RecordedUUID      string `json:"recordedUUID"`
+	CurrentHostIndex  string `json:"currentHostIndex,omitempty"`
+	CurrentUUID       string `json:"currentUUID,omitempty"`
+	Message           string `json:"message"`
+}
+
+type ClusterStatus string
+
+const (
+	ClusterRunning     ClusterStatus = "Running"
+	ClusterStopped     ClusterStatus = "Stopped"
+	ClusterDegraded    ClusterStatus = "Degraded"
+	ClusterUnreachable ClusterStatus = "Unreachable"
+)
+
+// ClusterSummary describes a kind cluster as returned by ListClusters.
+type ClusterSummary struct {
+	Name string `json:"name"`
+	// Managed is true for running clusters created by nvkind, i.e. those
+	// with the nvkind-cluster-config ConfigMap.
+	Managed bool              `json:"managed"`
+	Status  ClusterStatus     `json:"status"`
+	Workers int               `json:"workers"`
+	GPUs    int               `json:"gpus"`
+	Created time.Time         `json:"created"`
+	Labels  map[string]string `json:"labels,omitempty"`
 }
 
 type GPUInfo struct {
-	Index string
-	Name  string
-	UUID  string
+	Index         string
+	Name          string
+	UUID          string
+	MemoryMiB     uint64
+	DriverVersion string
+	CUDAVersion   string
+	PCIBusID      string
+	// ComputeCapability is only populated for GPUs that could be matched
+	// to a GPU on the host.
+	ComputeCapability string
+	// MigMode is the current MIG mode as reported by nvidia-smi, i.e.
+	// "Enabled", "Disabled" or "[N/A]" for GPUs without MIG support.
+	MigMode string
+	// HostIndex is the index of the GPU on the host, which generally differs
+	// from its index within the node.
+	HostIndex string
+}
+
+type HostGPU struct {
+	Index             int             `json:"index"`
+	Minor             int             `json:"minor"`
+	UUID              string          `json:"uuid"`
+	Name              string          `json:"name"`
+	MemoryMiB         uint64          `json:"memoryMiB"`
+	ComputeCapability string          `json:"computeCapability"`
+	PCIBusID          string          `json:"pciBusID"`
+	NUMANode          int             `json:"numaNode"`
+	NVLinkRemotes     []string        `json:"nvlinkRemotes,omitempty"`
+	MigEnabled        bool            `json:"migEnabled"`
+	MigDevices        []HostMigDevice `json:"migDevices,omitempty"`
+}
+
+type HostMigDevice struct {
+	Index      int    `json:"index"`
+	UUID       string `json:"uuid"`
+	GIID       int    `json:"giID"`
+	CIID       int    `json:"ciID"`
+	GICapMinor int    `json:"-"`
+	CICapMinor int    `json:"-"`
+}
+
+type DeviceAssignment struct {
+	Node      string `yaml:"node" json:"node"`
+	Device    string `yaml:"device" json:"device"`
+	HostIndex string `yaml:"hostIndex,omitempty" json:"hostIndex,omitempty"`
+	UUID      string `yaml:"uuid,omitempty" json:"uuid,omitempty"`
+	Name      string `yaml:"name,omitempty" json:"name,omitempty"`
 }
 
 type ConfigOptions struct {
@@ -73,6 +329,12 @@ type ConfigOptions struct {
 	configTemplate     []byte
 	configValuesPath   string
 	configValues       []byte
+	allowSharedGPUs    bool
+	toolkit            toolkitConfig
+	runtime            *ContainerRuntimeConfig
+	cdiDevices         cdiDeviceRequests
+	logger             *logr.Logger
+	progressHandler    ProgressHandler
 }
 
 type ConfigOption func(*ConfigOptions)
@@ -123,6 +385,65 @@ func WithConfigValues[T string | []byte](arg T) ConfigOption {
 	}
 }
 
+func WithAllowSharedGPUs() ConfigOption {
+	return func(o *ConfigOptions) {
+		o.allowSharedGPUs = true
+	}
+}
+
+// WithContainerToolkitChannel sets the release channel (stable or
+// experimental) the nvidia-container-toolkit is installed from.
+func WithContainerToolkitChannel(channel string) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.toolkit.channel = channel
+	}
+}
+
+// WithContainerToolkitVersion pins the version of the nvidia-container-toolkit
+// that gets installed (e.g. 1.15.0-1).
+func WithContainerToolkitVersion(version string) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.toolkit.version = version
+	}
+}
+
+// WithContainerToolkitPackages installs the nvidia-container-toolkit from a
+// host directory of .deb packages rather than from the network.
+func WithContainerToolkitPackages(dir string) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.toolkit.packagesDir = dir
+	}
+}
+
+// WithContainerToolkitAptMirror installs the nvidia-container-toolkit from a
+// host directory containing a flat apt repository rather than from the
+// network.
+func WithContainerToolkitAptMirror(dir string) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.toolkit.aptMirrorDir = dir
+	}
+}
+
+func WithContainerRuntimeConfig(config ContainerRuntimeConfig) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.runtime = &config
+	}
+}
+
+// WithLogger sets the logger progress is logged to. Raw output of the commands
+// run is still written to the writers set with WithOutput.
+func WithLogger(logger logr.Logger) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.logger = &logger
+	}
+}
+
+func WithProgressHandler(handler ProgressHandler) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.progressHandler = handler
+	}
+}
+
 func WithOutput(stdout, stderr io.Writer) ConfigOption {
 	return func(o *ConfigOptions) {
 		o.stdout = stdout
@@ -131,9 +452,10 @@ func WithOutput(stdout, stderr io.Writer) ConfigOption {
 }
 
 type ClusterOptions struct {
-	name       string
-	config     *Config
-	kubeconfig string
+	name          string
+	config        *Config
+	kubeconfig    string
+	configOptions []ConfigOption
 }
 
 type ClusterOption func(*ClusterOptions)
@@ -156,9 +478,18 @@ func WithKubeConfig(kubeconfig string) ClusterOption {
 	}
 }
 
+// WithConfigOptions sets additional options (e.g. WithOutput or WithLogger) on
+// the config loaded for an existing cluster.
+func WithConfigOptions(opts ...ConfigOption) ClusterOption {
+	return func(o *ClusterOptions) {
+		o.configOptions = append(o.configOptions, opts...)
+	}
+}
+
 type ClusterCreateOptions struct {
 	retain bool
 	wait   time.Duration
+	labels map[string]string
 }
 
 type ClusterCreateOption func(*ClusterCreateOptions)
@@ -174,3 +505,159 @@ func WithWait(wait time.Duration) ClusterCreateOption {
 		o.wait = wait
 	}
 }
+
+// WithLabels sets labels on the cluster that ListClusters can select it by.
+func WithLabels(labels map[string]string) ClusterCreateOption {
+	return func(o *ClusterCreateOptions) {
+		o.labels = labels
+	}
+}
+
+type ListClustersOptions struct {
+	selector  labels.Selector
+	unmanaged bool
+	nvml      nvml.Interface
+}
+
+type ListClustersOption func(*ListClustersOptions)
+
+// WithSelector only lists clusters whose labels match the given selector.
+// The labels of a cluster can only be read while it is running.
+func WithSelector(selector labels.Selector) ListClustersOption {
+	return func(o *ListClustersOptions) {
+		o.selector = selector
+	}
+}
+
+// WithUnmanagedClusters also lists kind clusters not created by nvkind.
+func WithUnmanagedClusters() ListClustersOption {
+	return func(o *ListClustersOptions) {
+		o.unmanaged = true
+	}
+}
+
+// WithListClustersNvml sets the nvml library used to resolve the devices of
+// each cluster to the GPUs of the host.
+func WithListClustersNvml(nvml nvml.Interface) ListClustersOption {
+	return func(o *ListClustersOptions) {
+		o.nvml = nvml
+	}
+}
+
+type AddonOptions struct {
+	source string
+	values []string
+}
+
+type AddonOption func(*AddonOptions)
+
+// WithAddonSource installs the addon from a local chart archive, chart
+// directory, or manifest file (or directory of manifests) instead of from its
+// remote helm repo.
+func WithAddonSource(path string) AddonOption {
+	return func(o *AddonOptions) {
+		o.source = path
+	}
+}
+
+// WithAddonValues sets additional helm values (as key=value) on the addon.
+// These take precedence over any values derived from the cluster.
+func WithAddonValues(values ...string) AddonOption {
+	return func(o *AddonOptions) {
+		o.values = append(o.values, values...)
+	}
+}
+
+type ProvisionOptions struct {
+	resume      bool
+	parallelism int
+}
+
+type ProvisionOption func(*ProvisionOptions)
+
+// WithResume skips the provisioning steps already recorded as completed on
+// each node.
+func WithResume() ProvisionOption {
+	return func(o *ProvisionOptions) {
+		o.resume = true
+	}
+}
+
+// WithParallelism sets the maximum number of nodes provisioned at once.
+func WithParallelism(parallelism int) ProvisionOption {
+	return func(o *ProvisionOptions) {
+		o.parallelism = parallelism
+	}
+}
+
+type ReconcileOptions struct {
+	nodes []string
+}
+
+type ReconcileOption func(*ReconcileOptions)
+
+// WithReconcileNodes only reconciles the nodes with the given names.
+func WithReconcileNodes(names ...string) ReconcileOption {
+	return func(o *ReconcileOptions) {
+		o.nodes = append(o.nodes, names...)
+	}
+}
+
+type VerifyOptions struct {
+	image     string
+	namespace string
+	timeout   time.Duration
+}
+
+type VerifyOption func(*VerifyOptions)
+
+// WithVerifyImage sets the image of the pods run on each GPU worker. It must
+// have nvidia-smi available once the nvidia-container-runtime has injected
+// the GPUs.
+func WithVerifyImage(image string) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.image = image
+	}
+}
+
+func WithVerifyNamespace(namespace string) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.namespace = namespace
+	}
+}
+
+func WithVerifyTimeout(timeout time.Duration) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.timeout = timeout
+	}
+}
+
+type NodeImageOptions struct {
+	baseImage     string
+	tag           string
+	configOptions []ConfigOption
+}
+
+type NodeImageOption func(*NodeImageOptions)
+
+func WithBaseImage(image string) NodeImageOption {
+	return func(o *NodeImageOptions) {
+		o.baseImage = image
+	}
+}
+
+func WithTag(tag string) NodeImageOption {
+	return func(o *NodeImageOptions) {
+		o.tag = tag
+	}
+}
+
+// WithNodeImageConfigOptions sets the options from which the settings used to
+// install and configure the nvidia-container-toolkit and the output streams
+// are taken. No config template is rendered, so no GPUs are needed to build an
+// image.
+func WithNodeImageConfigOptions(opts ...ConfigOption) NodeImageOption {
+	return func(o *NodeImageOptions) {
+		o.configOptions = append(o.configOptions, opts...)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvml"
+	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+func (c *Config) GetDeviceAssignments() ([]DeviceAssignment, error) {
+	return getDeviceAssignments(c.Cluster, c.cdiDevices, c.nvml)
+}
+
+// getDeviceAssignments resolves the devices referenced by each node of a
+// cluster to the host devices they correspond to. Devices that cannot be
+// resolved are included without any host information.
+func getDeviceAssignments(cluster *kind.Cluster, cdiDevices cdiDeviceRequests, nvmllib nvml.Interface) ([]DeviceAssignment, error) {
+	return resolveDeviceAssignments(cluster, cdiDevices, func() ([]HostGPU, error) {
+		return getHostGPUs(nvmllib)
+	})
+}
+
+// resolveDeviceAssignments resolves the devices referenced by each node of a
+// cluster against the GPUs returned by getGPUs, which is only called if any
+// node references a device.
+func resolveDeviceAssignments(cluster *kind.Cluster, cdiDevices cdiDeviceRequests, getGPUs func() ([]HostGPU, error)) ([]DeviceAssignment, error) {
+	var gpus []HostGPU
+	var assignments []DeviceAssignment
+
+	nodeNames := getNodeNames(cluster)
+	for i := range cluster.Nodes {
+		for _, device := range getNvidiaVisibleDevices(&cluster.Nodes[i], cdiDevices.forNode(i)) {
+			if gpus == nil {
+				var err error
+				gpus, err = getGPUs()
+				if err != nil {
+					return nil, fmt.Errorf("getting host GPUs: %w", err)
+				}
+			}
+
+			id := device
+			if ids := getDeviceIDs([]string{device}); len(ids) == 1 {
+				id = ids[0]
+			}
+
+			if id == "all" {
+				for _, gpu := range gpus {
+					assignments = append(assignments, newDeviceAssignment(nodeNames[i], device, &gpu, nil))
+				}
+				continue
+			}
+
+			gpu, mig, _ := resolveDevice(gpus, id)
+			assignments = append(assignments, newDeviceAssignment(nodeNames[i], device, gpu, mig))
+		}
+	}
+
+	return assignments, nil
+}
+
+func newDeviceAssignment(node, device string, gpu *HostGPU, mig *HostMigDevice) DeviceAssignment {
+	assignment := DeviceAssignment{
+		Node:   node,
+		Device: device,
+	}
+
+	switch {
+	case gpu == nil:
+	case mig == nil:
+		assignment.HostIndex = strconv.Itoa(gpu.Index)
+		assignment.UUID = gpu.UUID
+		assignment.Name = gpu.Name
+	default:
+		assignment.HostIndex = fmt.Sprintf("%d:%d", gpu.Index, mig.Index)
+		assignment.UUID = mig.UUID
+		assignment.Name = gpu.Name
+	}
+
+	return assignment
+}
+
+// isMigDevice returns true if the assignment is of a MIG device rather than a
+// full GPU, even if it could not be resolved on the host.
+func (a *DeviceAssignment) isMigDevice() bool {
+	if a.UUID != "" {
+		return strings.HasPrefix(a.UUID, "MIG-")
+	}
+	id := a.Device
+	if ids := getDeviceIDs([]string{id}); len(ids) == 1 {
+		id = ids[0]
+	}
+	return strings.HasPrefix(id, "MIG-") || migDeviceIndexRegexp.MatchString(id)
+}
@@ -0,0 +1,373 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+// hostCDISpecDirs are the directories CDI specs are read from on the host, in
+// increasing order of priority.
+var hostCDISpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+// cdiSpec is the subset of a CDI spec nvkind needs to inject its devices into
+// a node itself, without the help of a container runtime.
+type cdiSpec struct {
+	Kind           string            `yaml:"kind"`
+	Devices        []cdiDevice       `yaml:"devices"`
+	ContainerEdits cdiContainerEdits `yaml:"containerEdits"`
+}
+
+type cdiDevice struct {
+	Name           string            `yaml:"name"`
+	ContainerEdits cdiContainerEdits `yaml:"containerEdits"`
+}
+
+type cdiContainerEdits struct {
+	Env            []string        `yaml:"env"`
+	DeviceNodes    []cdiDeviceNode `yaml:"deviceNodes"`
+	Mounts         []cdiMount      `yaml:"mounts"`
+	Hooks          []cdiHook       `yaml:"hooks"`
+	AdditionalGIDs []uint32        `yaml:"additionalGids"`
+}
+
+type cdiDeviceNode struct {
+	Path        string  `yaml:"path"`
+	HostPath    string  `yaml:"hostPath"`
+	Type        string  `yaml:"type"`
+	Major       int64   `yaml:"major"`
+	Minor       int64   `yaml:"minor"`
+	FileMode    *uint32 `yaml:"fileMode"`
+	Permissions string  `yaml:"permissions"`
+	UID         *uint32 `yaml:"uid"`
+	GID         *uint32 `yaml:"gid"`
+}
+
+type cdiMount struct {
+	HostPath      string   `yaml:"hostPath"`
+	ContainerPath string   `yaml:"containerPath"`
+	Options       []string `yaml:"options"`
+}
+
+type cdiHook struct {
+	HookName string   `yaml:"hookName"`
+	Path     string   `yaml:"path"`
+	Args     []string `yaml:"args"`
+}
+
+// cdiDeviceRequests holds the fully qualified names of the CDI devices
+// requested by each node of a cluster, in the order of its nodes. They are
+// set through the cdiDevices field of a node in the config template, which
+// nvkind removes before passing the config on to kind.
+type cdiDeviceRequests [][]string
+
+// forNode returns the CDI devices requested by the i-th node of a cluster.
+func (r cdiDeviceRequests) forNode(i int) []string {
+	if i >= len(r) {
+		return nil
+	}
+	return r[i]
+}
+
+// getCDIDeviceRequests returns the CDI devices requested by each node of a
+// rendered config template.
+func getCDIDeviceRequests(configBytes []byte) (cdiDeviceRequests, error) {
+	var config struct {
+		Nodes []struct {
+			CDIDevices []string `yaml:"cdiDevices"`
+		} `yaml:"nodes"`
+	}
+	if err := yaml.Unmarshal(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("unmarshaling YAML: %w", err)
+	}
+
+	var requests cdiDeviceRequests
+	for i, node := range config.Nodes {
+		for _, device := range node.CDIDevices {
+			if kind, _, _ := strings.Cut(device, "="); kind != nvidiaGPUCDIKind {
+				return nil, fmt.Errorf("unsupported CDI device: %v", device)
+			}
+		}
+		if len(node.CDIDevices) == 0 {
+			continue
+		}
+		for len(requests) <= i {
+			requests = append(requests, nil)
+		}
+		requests[i] = node.CDIDevices
+	}
+
+	return requests, nil
+}
+
+// getHostCDISpec reads the CDI spec for devices of kind nvidia.com/gpu from the
+// host. Specs in later directories take precedence over those in earlier ones.
+func getHostCDISpec() (*cdiSpec, error) {
+	var found *cdiSpec
+	for _, dir := range hostCDISpecDirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading directory: %w", err)
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yaml" && ext != ".json") {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("reading file: %w", err)
+			}
+			var spec cdiSpec
+			if err := yaml.Unmarshal(data, &spec); err != nil {
+				return nil, fmt.Errorf("unmarshaling %v: %w", path, err)
+			}
+			if spec.Kind == nvidiaGPUCDIKind {
+				found = &spec
+			}
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no CDI spec for %v found in %v", nvidiaGPUCDIKind, strings.Join(hostCDISpecDirs, ", "))
+	}
+	return found, nil
+}
+
+// getContainerEdits returns the edits to apply to a container for it to have
+// access to the given fully qualified CDI devices, including those common to
+// all devices of the spec.
+func (s *cdiSpec) getContainerEdits(devices []string) ([]cdiContainerEdits, error) {
+	edits := []cdiContainerEdits{s.ContainerEdits}
+	for _, device := range devices {
+		kind, name, _ := strings.Cut(device, "=")
+		if kind != s.Kind {
+			return nil, fmt.Errorf("unsupported CDI device kind: %v", kind)
+		}
+		i := slices.IndexFunc(s.Devices, func(d cdiDevice) bool { return d.Name == name })
+		if i == -1 {
+			return nil, fmt.Errorf("CDI device not found: %v", device)
+		}
+		edits = append(edits, s.Devices[i].ContainerEdits)
+	}
+	return edits, nil
+}
+
+// resolveCDIDevices injects the CDI devices requested by each node by adding
+// extra mounts for the device nodes and files listed in their CDI specs, as a
+// CDI-enabled container runtime would. Hooks are run on the node once it is up
+// (see ApplyCDIHooks).
+func resolveCDIDevices(cluster *kind.Cluster, requests cdiDeviceRequests) error {
+	nodeNames := getNodeNames(cluster)
+
+	var spec *cdiSpec
+	for i := range cluster.Nodes {
+		node := &cluster.Nodes[i]
+		devices := requests.forNode(i)
+		if len(devices) == 0 {
+			continue
+		}
+
+		if spec == nil {
+			var err error
+			spec, err = getHostCDISpec()
+			if err != nil {
+				return fmt.Errorf("getting CDI spec: %w", err)
+			}
+		}
+
+		edits, err := spec.getContainerEdits(devices)
+		if err != nil {
+			return err
+		}
+
+		for _, edit := range edits {
+			mounts, err := translateContainerEdits(edit)
+			if err != nil {
+				return fmt.Errorf("node %v: %w", nodeNames[i], err)
+			}
+			for _, mount := range mounts {
+				addExtraMount(node, mount)
+			}
+		}
+	}
+
+	return nil
+}
+
+// cdiMountOptions are the mount options a CDI spec may set on a mount. Options
+// other than ro only restrict what can be done through a mount, which is moot
+// for the privileged container of a kind node.
+var cdiMountOptions = []string{"ro", "rw", "bind", "rbind", "nosuid", "nodev", "noexec"}
+
+// translateContainerEdits returns the extra mounts equivalent to the device
+// nodes and mounts of the given edits. It fails if the edits contain anything
+// that can neither be expressed as an extra mount nor run by ApplyCDIHooks.
+func translateContainerEdits(edits cdiContainerEdits) ([]kind.Mount, error) {
+	for _, env := range edits.Env {
+		// Only meant for the nvidia-container-runtime, which does not
+		// start kind nodes
+		if env == "NVIDIA_VISIBLE_DEVICES=void" {
+			continue
+		}
+		return nil, fmt.Errorf("unsupported CDI environment variable: %v", env)
+	}
+	if len(edits.AdditionalGIDs) != 0 {
+		return nil, fmt.Errorf("unsupported CDI additional GIDs: %v", edits.AdditionalGIDs)
+	}
+	for _, hook := range edits.Hooks {
+		if _, supported := getCDIHookCommands(hook); !supported {
+			return nil, fmt.Errorf("unsupported CDI hook: %v %v", hook.HookName, strings.Join(hook.Args, " "))
+		}
+	}
+
+	var mounts []kind.Mount
+	for _, deviceNode := range edits.DeviceNodes {
+		if deviceNode.Type != "" || deviceNode.Major != 0 || deviceNode.Minor != 0 || deviceNode.FileMode != nil ||
+			deviceNode.Permissions != "" || deviceNode.UID != nil || deviceNode.GID != nil {
+			return nil, fmt.Errorf("unsupported CDI device node attributes: %v", deviceNode.Path)
+		}
+		hostPath := deviceNode.HostPath
+		if hostPath == "" {
+			hostPath = deviceNode.Path
+		}
+		mounts = append(mounts, kind.Mount{
+			HostPath:      hostPath,
+			ContainerPath: deviceNode.Path,
+		})
+	}
+	for _, mount := range edits.Mounts {
+		for _, option := range mount.Options {
+			if !slices.Contains(cdiMountOptions, option) {
+				return nil, fmt.Errorf("unsupported CDI mount option for %v: %v", mount.ContainerPath, option)
+			}
+		}
+		mounts = append(mounts, kind.Mount{
+			HostPath:      mount.HostPath,
+			ContainerPath: mount.ContainerPath,
+			Readonly:      slices.Contains(mount.Options, "ro"),
+		})
+	}
+
+	return mounts, nil
+}
+
+// addExtraMount adds a mount to a node unless something is already mounted at
+// its container path.
+func addExtraMount(node *kind.Node, mount kind.Mount) {
+	for _, m := range node.ExtraMounts {
+		if m.ContainerPath == mount.ContainerPath {
+			return
+		}
+	}
+	node.ExtraMounts = append(node.ExtraMounts, mount)
+}
+
+func (n *Node) hasCDIDevices() bool {
+	return len(n.cdiDevices) != 0
+}
+
+// ApplyCDIHooks runs the equivalent of the hooks listed in the CDI specs of the
+// CDI devices injected into the node.
+func (n *Node) ApplyCDIHooks(ctx context.Context) error {
+	if !n.hasCDIDevices() {
+		return nil
+	}
+
+	spec, err := getHostCDISpec()
+	if err != nil {
+		return fmt.Errorf("getting CDI spec: %w", err)
+	}
+
+	edits, err := spec.getContainerEdits(n.cdiDevices)
+	if err != nil {
+		return err
+	}
+
+	var script []string
+	for _, edit := range edits {
+		for _, hook := range edit.Hooks {
+			commands, supported := getCDIHookCommands(hook)
+			if !supported {
+				return fmt.Errorf("unsupported CDI hook: %v %v", hook.HookName, strings.Join(hook.Args, " "))
+			}
+			script = append(script, commands...)
+		}
+	}
+	if len(script) == 0 {
+		return nil
+	}
+
+	if err := n.runScript(ctx, strings.Join(script, "\n")); err != nil {
+		return fmt.Errorf("running script on %v: %w", n.Name, err)
+	}
+	return nil
+}
+
+// getCDIHookCommands returns the shell commands equivalent to running a hook
+// of the nvidia-ctk, or false if the hook is not one of those understood.
+func getCDIHookCommands(hook cdiHook) ([]string, bool) {
+	if hook.HookName != "createContainer" || len(hook.Args) < 3 || hook.Args[1] != "hook" {
+		return nil, false
+	}
+
+	switch hook.Args[2] {
+	case "create-symlinks":
+		var commands []string
+		for i := 3; i < len(hook.Args)-1; i++ {
+			if hook.Args[i] != "--link" {
+				continue
+			}
+			target, link, found := strings.Cut(hook.Args[i+1], "::")
+			if !found {
+				return nil, false
+			}
+			commands = append(commands, fmt.Sprintf("mkdir -p %q && ln -sfn %q %q", filepath.Dir(link), target, link))
+		}
+		return commands, true
+	case "chmod":
+		var mode string
+		var paths []string
+		for i := 3; i < len(hook.Args)-1; i++ {
+			switch hook.Args[i] {
+			case "--mode":
+				mode = hook.Args[i+1]
+			case "--path":
+				paths = append(paths, fmt.Sprintf("%q", hook.Args[i+1]))
+			}
+		}
+		if mode == "" || len(paths) == 0 {
+			return nil, false
+		}
+		return []string{fmt.Sprintf("chmod %q %s", mode, strings.Join(paths, " "))}, true
+	case "update-ldcache":
+		return []string{"ldconfig"}, true
+	}
+
+	return nil, false
+}
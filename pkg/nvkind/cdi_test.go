@@ -0,0 +1,294 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package nvkind
+
+import (
+	"reflect"
+	"testing"
+
+	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+func TestGetCDIHookCommands(t *testing.T) {
+	testCases := []struct {
+		description       string
+		hook              cdiHook
+		expected          []string
+		expectedSupported bool
+	}{
+		{
+			description: "create-symlinks",
+			hook: cdiHook{
+				HookName: "createContainer",
+				Path:     "/usr/bin/nvidia-ctk",
+				Args: []string{
+					"nvidia-ctk", "hook", "create-symlinks",
+					"--link", "libcuda.so.1::/usr/lib/x86_64-linux-gnu/libcuda.so",
+					"--link", "../card1::/dev/dri/by-path/pci-0000:07:00.0-card",
+				},
+			},
+			expected: []string{
+				`mkdir -p "/usr/lib/x86_64-linux-gnu" && ln -sfn "libcuda.so.1" "/usr/lib/x86_64-linux-gnu/libcuda.so"`,
+				`mkdir -p "/dev/dri/by-path" && ln -sfn "../card1" "/dev/dri/by-path/pci-0000:07:00.0-card"`,
+			},
+			expectedSupported: true,
+		},
+		{
+			description: "create-symlinks with a malformed link",
+			hook: cdiHook{
+				HookName: "createContainer",
+				Args:     []string{"nvidia-ctk", "hook", "create-symlinks", "--link", "libcuda.so.1"},
+			},
+		},
+		{
+			description: "chmod",
+			hook: cdiHook{
+				HookName: "createContainer",
+				Args:     []string{"nvidia-ctk", "hook", "chmod", "--mode", "755", "--path", "/dev/dri", "--path", "/dev/dri/by-path"},
+			},
+			expected:          []string{`chmod "755" "/dev/dri" "/dev/dri/by-path"`},
+			expectedSupported: true,
+		},
+		{
+			description: "chmod without paths",
+			hook: cdiHook{
+				HookName: "createContainer",
+				Args:     []string{"nvidia-ctk", "hook", "chmod", "--mode", "755"},
+			},
+		},
+		{
+			description: "update-ldcache",
+			hook: cdiHook{
+				HookName: "createContainer",
+				Args:     []string{"nvidia-ctk", "hook", "update-ldcache", "--folder", "/usr/lib/x86_64-linux-gnu"},
+			},
+			expected:          []string{"ldconfig"},
+			expectedSupported: true,
+		},
+		{
+			description: "unknown hook",
+			hook: cdiHook{
+				HookName: "createContainer",
+				Args:     []string{"nvidia-ctk", "hook", "disable-device-node-modification"},
+			},
+		},
+		{
+			description: "other lifecycle stage",
+			hook: cdiHook{
+				HookName: "startContainer",
+				Args:     []string{"nvidia-ctk", "hook", "update-ldcache"},
+			},
+		},
+		{
+			description: "not an nvidia-ctk hook",
+			hook: cdiHook{
+				HookName: "createContainer",
+				Args:     []string{"/bin/true"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			commands, supported := getCDIHookCommands(tc.hook)
+			if supported != tc.expectedSupported {
+				t.Fatalf("expected supported to be %v, got %v", tc.expectedSupported, supported)
+			}
+			if !reflect.DeepEqual(commands, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, commands)
+			}
+		})
+	}
+}
+
+func TestTranslateContainerEdits(t *testing.T) {
+	fileMode := uint32(0666)
+
+	testCases := []struct {
+		description   string
+		edits         cdiContainerEdits
+		expected      []kind.Mount
+		expectedError bool
+	}{
+		{
+			description: "device nodes and mounts",
+			edits: cdiContainerEdits{
+				Env: []string{"NVIDIA_VISIBLE_DEVICES=void"},
+				DeviceNodes: []cdiDeviceNode{
+					{Path: "/dev/nvidia0"},
+					{Path: "/dev/nvidia-caps/nvidia-cap1", HostPath: "/dev/nvidia-caps/nvidia-cap1"},
+				},
+				Mounts: []cdiMount{
+					{
+						HostPath:      "/usr/bin/nvidia-smi",
+						ContainerPath: "/usr/bin/nvidia-smi",
+						Options:       []string{"ro", "nosuid", "nodev", "bind"},
+					},
+					{
+						HostPath:      "/run/nvidia-persistenced/socket",
+						ContainerPath: "/run/nvidia-persistenced/socket",
+						Options:       []string{"rw", "rbind"},
+					},
+				},
+				Hooks: []cdiHook{
+					{HookName: "createContainer", Args: []string{"nvidia-ctk", "hook", "update-ldcache"}},
+				},
+			},
+			expected: []kind.Mount{
+				{HostPath: "/dev/nvidia0", ContainerPath: "/dev/nvidia0"},
+				{HostPath: "/dev/nvidia-caps/nvidia-cap1", ContainerPath: "/dev/nvidia-caps/nvidia-cap1"},
+				{HostPath: "/usr/bin/nvidia-smi", ContainerPath: "/usr/bin/nvidia-smi", Readonly: true},
+				{HostPath: "/run/nvidia-persistenced/socket", ContainerPath: "/run/nvidia-persistenced/socket"},
+			},
+		},
+		{
+			description: "environment variable",
+			edits: cdiContainerEdits{
+				Env: []string{"NVIDIA_DRIVER_CAPABILITIES=all"},
+			},
+			expectedError: true,
+		},
+		{
+			description: "additional GIDs",
+			edits: cdiContainerEdits{
+				AdditionalGIDs: []uint32{44},
+			},
+			expectedError: true,
+		},
+		{
+			description: "unsupported hook",
+			edits: cdiContainerEdits{
+				Hooks: []cdiHook{
+					{HookName: "createContainer", Args: []string{"nvidia-ctk", "hook", "disable-device-node-modification"}},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			description: "device node attributes",
+			edits: cdiContainerEdits{
+				DeviceNodes: []cdiDeviceNode{
+					{Path: "/dev/nvidia0", FileMode: &fileMode},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			description: "unsupported mount option",
+			edits: cdiContainerEdits{
+				Mounts: []cdiMount{
+					{HostPath: "/tmp", ContainerPath: "/tmp", Options: []string{"rprivate"}},
+				},
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			mounts, err := translateContainerEdits(tc.edits)
+			if tc.expectedError {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", mounts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(mounts, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, mounts)
+			}
+		})
+	}
+}
+
+func TestGetCDIDeviceRequests(t *testing.T) {
+	testCases := []struct {
+		description   string
+		config        string
+		expected      cdiDeviceRequests
+		expectedError bool
+	}{
+		{
+			description: "no CDI devices",
+			config: `
+nodes:
+- role: control-plane
+- role: worker
+`,
+		},
+		{
+			description: "CDI devices on some nodes",
+			config: `
+nodes:
+- role: control-plane
+- role: worker
+  cdiDevices:
+  - "nvidia.com/gpu=0"
+  - "nvidia.com/gpu=0:1"
+- role: worker
+- role: worker
+  cdiDevices: ["nvidia.com/gpu=GPU-4404041a-04cf-1ccf-9e70-f139a9b1e23c"]
+`,
+			expected: cdiDeviceRequests{
+				nil,
+				{"nvidia.com/gpu=0", "nvidia.com/gpu=0:1"},
+				nil,
+				{"nvidia.com/gpu=GPU-4404041a-04cf-1ccf-9e70-f139a9b1e23c"},
+			},
+		},
+		{
+			description: "other CDI kind",
+			config: `
+nodes:
+- role: worker
+  cdiDevices: ["vendor.com/device=0"]
+`,
+			expectedError: true,
+		},
+		{
+			description: "not fully qualified",
+			config: `
+nodes:
+- role: worker
+  cdiDevices: ["0"]
+`,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			requests, err := getCDIDeviceRequests([]byte(tc.config))
+			if tc.expectedError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(requests, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, requests)
+			}
+			if requests.forNode(len(tc.expected)) != nil {
+				t.Errorf("expected no CDI devices past the last node")
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Check compares the host GPUs each worker of the cluster was given when it
+// was created to the host GPUs its devices refer to now.
+func (c *Cluster) Check(ctx context.Context) (*CheckReport, error) {
+	data, err := getConfigMapDataFromExistingCluster(ctx, c.Name)
+	if err != nil {
+		return nil, fmt.Errorf("getting configmap data: %w", err)
+	}
+
+	metadata, err := getClusterMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("getting cluster metadata: %w", err)
+	}
+
+	report := &CheckReport{
+		Cluster:  c.Name,
+		Recorded: !metadata.CreationTimestamp.IsZero(),
+	}
+	if !report.Recorded {
+		return report, nil
+	}
+
+	gpus, err := getHostGPUs(c.nvml)
+	if err != nil {
+		return nil, fmt.Errorf("getting host GPUs: %w", err)
+	}
+
+	report.Drift = checkDeviceAssignments(metadata.Devices, gpus)
+
+	return report, nil
+}
+
+// Passed returns true if the devices of every worker still refer to the same
+// host GPUs as when the cluster was created.
+func (r *CheckReport) Passed() bool {
+	return len(r.Drift) == 0
+}
+
+// AffectedNodes returns the names of the nodes with at least one device that
+// no longer refers to the same host GPU, sorted by name.
+func (r *CheckReport) AffectedNodes() []string {
+	nodes := sets.New[string]()
+	for _, drift := range r.Drift {
+		nodes.Insert(drift.Node)
+	}
+	return sets.List(nodes)
+}
+
+func checkDeviceAssignments(recorded []DeviceAssignment, gpus []HostGPU) []DeviceDrift {
+	hostIndices := make(map[string]string)
+	for _, gpu := range gpus {
+		hostIndices[gpu.UUID] = strconv.Itoa(gpu.Index)
+		for _, mig := range gpu.MigDevices {
+			hostIndices[mig.UUID] = fmt.Sprintf("%d:%d", gpu.Index, mig.Index)
+		}
+	}
+
+	var drifts []DeviceDrift
+	for _, assignment := range recorded {
+		if assignment.UUID == "" {
+			// The device did not resolve to a host GPU to begin with
+			continue
+		}
+
+		id := assignment.Device
+		if ids := getDeviceIDs([]string{id}); len(ids) == 1 {
+			id = ids[0]
+		}
+
+		drift := DeviceDrift{
+			Node:              assignment.Node,
+			Device:            assignment.Device,
+			RecordedHostIndex: assignment.HostIndex,
+			RecordedUUID:      assignment.UUID,
+		}
+
+		// Nodes given all GPUs are only affected by GPUs going missing
+		if id == "all" {
+			if _, exists := hostIndices[assignment.UUID]; exists {
+				continue
+			}
+			drift.Message = fmt.Sprintf("%v (host GPU %v) is no longer present on the host", assignment.UUID, assignment.HostIndex)
+			drifts = append(drifts, drift)
+			continue
+		}
+
+		gpu, mig, _ := resolveDevice(gpus, id)
+		current := newDeviceAssignment(assignment.Node, assignment.Device, gpu, mig)
+		if current.UUID == assignment.UUID {
+			continue
+		}
+
+		drift.CurrentHostIndex = current.HostIndex
+		drift.CurrentUUID = current.UUID
+		if current.UUID == "" {
+			drift.Message = fmt.Sprintf("device %v no longer refers to any host GPU", assignment.Device)
+		} else {
+			drift.Message = fmt.Sprintf("device %v now refers to %v (host GPU %v) instead of %v", assignment.Device, current.UUID, current.HostIndex, assignment.UUID)
+		}
+		if hostIndex, exists := hostIndices[assignment.UUID]; exists {
+			drift.Message += fmt.Sprintf("; %v is now host GPU %v", assignment.UUID, hostIndex)
+		} else {
+			drift.Message += fmt.Sprintf("; %v is no longer present on the host", assignment.UUID)
+		}
+
+		drifts = append(drifts, drift)
+	}
+
+	return drifts
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package nvkind
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckDeviceAssignments(t *testing.T) {
+	gpus := []HostGPU{
+		{Index: 0, UUID: testGPU0UUID, Name: "NVIDIA A100-SXM4-40GB"},
+		{
+			Index: 1,
+			UUID:  testGPU1UUID,
+			Name:  "NVIDIA A100-SXM4-40GB",
+			MigDevices: []HostMigDevice{
+				{Index: 0, UUID: testMIG0UUID},
+			},
+		},
+	}
+	swapped := []HostGPU{
+		{Index: 0, UUID: testGPU1UUID, Name: "NVIDIA A100-SXM4-40GB"},
+		{Index: 1, UUID: testGPU0UUID, Name: "NVIDIA A100-SXM4-40GB"},
+	}
+
+	testCases := []struct {
+		description string
+		recorded    []DeviceAssignment
+		gpus        []HostGPU
+		expected    []DeviceDrift
+	}{
+		{
+			description: "unchanged",
+			recorded: []DeviceAssignment{
+				{Node: "worker", Device: "0", HostIndex: "0", UUID: testGPU0UUID},
+				{Node: "worker2", Device: "1:0", HostIndex: "1:0", UUID: testMIG0UUID},
+				{Node: "worker3", Device: "nvidia.com/gpu=" + testGPU1UUID, HostIndex: "1", UUID: testGPU1UUID},
+			},
+			gpus: gpus,
+		},
+		{
+			description: "GPUs reordered",
+			recorded: []DeviceAssignment{
+				{Node: "worker", Device: "0", HostIndex: "0", UUID: testGPU0UUID},
+				{Node: "worker2", Device: testGPU1UUID, HostIndex: "1", UUID: testGPU1UUID},
+			},
+			gpus: swapped,
+			expected: []DeviceDrift{
+				{
+					Node:              "worker",
+					Device:            "0",
+					RecordedHostIndex: "0",
+					RecordedUUID:      testGPU0UUID,
+					CurrentHostIndex:  "0",
+					CurrentUUID:       testGPU1UUID,
+					Message:           "device 0 now refers to " + testGPU1UUID + " (host GPU 0) instead of " + testGPU0UUID + "; " + testGPU0UUID + " is now host GPU 1",
+				},
+			},
+		},
+		{
+			description: "GPU removed",
+			recorded: []DeviceAssignment{
+				{Node: "worker", Device: "1", HostIndex: "1", UUID: testGPU1UUID},
+			},
+			gpus: gpus[:1],
+			expected: []DeviceDrift{
+				{
+					Node:              "worker",
+					Device:            "1",
+					RecordedHostIndex: "1",
+					RecordedUUID:      testGPU1UUID,
+					Message:           "device 1 no longer refers to any host GPU; " + testGPU1UUID + " is no longer present on the host",
+				},
+			},
+		},
+		{
+			description: "all GPUs with one removed",
+			recorded: []DeviceAssignment{
+				{Node: "worker", Device: "all", HostIndex: "0", UUID: testGPU0UUID},
+				{Node: "worker", Device: "all", HostIndex: "1", UUID: testGPU1UUID},
+			},
+			gpus: gpus[:1],
+			expected: []DeviceDrift{
+				{
+					Node:              "worker",
+					Device:            "all",
+					RecordedHostIndex: "1",
+					RecordedUUID:      testGPU1UUID,
+					Message:           testGPU1UUID + " (host GPU 1) is no longer present on the host",
+				},
+			},
+		},
+		{
+			description: "all GPUs reordered",
+			recorded: []DeviceAssignment{
+				{Node: "worker", Device: "all", HostIndex: "0", UUID: testGPU0UUID},
+				{Node: "worker", Device: "all", HostIndex: "1", UUID: testGPU1UUID},
+			},
+			gpus: swapped,
+		},
+		{
+			description: "unresolved devices are ignored",
+			recorded: []DeviceAssignment{
+				{Node: "worker", Device: "7"},
+			},
+			gpus: gpus,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			drifts := checkDeviceAssignments(tc.recorded, tc.gpus)
+			if !reflect.DeepEqual(drifts, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, drifts)
+			}
+		})
+	}
+}
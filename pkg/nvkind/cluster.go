@@ -19,15 +19,19 @@ package nvkind
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 
 	"gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
@@ -38,15 +42,53 @@ import (
 )
 
 const (
-	nvkindClusterConfigName = "nvkind-cluster-config"
+	nvkindClusterConfigName             = "nvkind-cluster-config"
+	nvkindClusterConfigSchemaVersionKey = "schemaVersion"
+	nvkindClusterConfigKey              = "config"
+	nvkindClusterConfigTemplateKey      = "template"
+	nvkindClusterConfigValuesKey        = "values"
+	nvkindClusterConfigMetadataKey      = "metadata"
+	nvkindClusterConfigToolkitKey       = "containerToolkit"
+	nvkindClusterConfigRuntimeKey       = "containerRuntime"
+	nvkindClusterConfigCDIDevicesKey    = "cdiDevices"
+	nvkindClusterConfigProvisioningKey  = "provisioning"
 )
 
-func GetClusterNames() (sets.Set[string], error) {
+// containerToolkitRecord is stored alongside the config of a cluster to
+// record how the nvidia-container-toolkit was installed on its nodes.
+type containerToolkitRecord struct {
+	Channel   string            `yaml:"channel,omitempty"`
+	Version   string            `yaml:"version,omitempty"`
+	Packages  string            `yaml:"packages,omitempty"`
+	AptMirror string            `yaml:"aptMirror,omitempty"`
+	Installed map[string]string `yaml:"installed,omitempty"`
+}
+
+// configOptions returns the options to install the nvidia-container-toolkit
+// the same way it was recorded to be installed.
+func (r *containerToolkitRecord) configOptions() []ConfigOption {
+	var options []ConfigOption
+	if r.Channel != "" {
+		options = append(options, WithContainerToolkitChannel(r.Channel))
+	}
+	if r.Version != "" {
+		options = append(options, WithContainerToolkitVersion(r.Version))
+	}
+	if r.Packages != "" {
+		options = append(options, WithContainerToolkitPackages(r.Packages))
+	}
+	if r.AptMirror != "" {
+		options = append(options, WithContainerToolkitAptMirror(r.AptMirror))
+	}
+	return options
+}
+
+func GetClusterNames(ctx context.Context) (sets.Set[string], error) {
 	command := []string{
 		"kind", "get", "clusters", "-q",
 	}
 
-	cmd := exec.Command(command[0], command[1:]...)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("executing command: %w", err)
@@ -55,12 +97,12 @@ func GetClusterNames() (sets.Set[string], error) {
 	return sets.New(strings.Fields(string(output))...), nil
 }
 
-func NewCluster(opts ...ClusterOption) (*Cluster, error) {
+func NewCluster(ctx context.Context, opts ...ClusterOption) (*Cluster, error) {
 	o := ClusterOptions{}
 	for _, opt := range opts {
 		opt(&o)
 	}
-	if err := o.setConfig(); err != nil {
+	if err := o.setConfig(ctx); err != nil {
 		return nil, fmt.Errorf("setting config: %w", err)
 	}
 	if o.name == "" {
@@ -73,18 +115,25 @@ func NewCluster(opts ...ClusterOption) (*Cluster, error) {
 	}
 
 	cluster := &Cluster{
-		Name:       o.name,
-		config:     o.config.Cluster,
-		kubeconfig: o.kubeconfig,
-		nvml:       o.config.nvml,
-		stdout:     o.config.stdout,
-		stderr:     o.config.stderr,
+		Name:            o.name,
+		config:          o.config.Cluster,
+		kubeconfig:      o.kubeconfig,
+		nvml:            o.config.nvml,
+		stdout:          o.config.stdout,
+		stderr:          o.config.stderr,
+		progress:        o.config.progress,
+		allowSharedGPUs: o.config.allowSharedGPUs,
+		toolkit:         o.config.toolkit,
+		runtime:         o.config.runtime,
+		cdiDevices:      o.config.cdiDevices,
+		configTemplate:  o.config.configTemplate,
+		configValues:    o.config.configValues,
 	}
 
 	return cluster, nil
 }
 
-func (c *Cluster) Create(opts ...ClusterCreateOption) error {
+func (c *Cluster) Create(ctx context.Context, opts ...ClusterCreateOption) error {
 	command := []string{
 		"kind", "create", "cluster",
 		"--name", c.Name,
@@ -102,34 +151,127 @@ func (c *Cluster) Create(opts ...ClusterCreateOption) error {
 		command = append(command, "--wait", o.wait.String())
 	}
 
+	if err := validateConfig(c.config, c.cdiDevices, c.nvml, c.allowSharedGPUs); err != nil {
+		return notCreatedError{fmt.Errorf("validating config: %w", err)}
+	}
+
 	configBytes, err := yaml.Marshal(c.config)
+	if err != nil {
+		return notCreatedError{fmt.Errorf("marshaling YAML: %w", err)}
+	}
+
+	err = c.progress.runStep("", "Creating cluster", func() error {
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Stdin = bytes.NewBuffer(configBytes)
+		cmd.Stdout = c.stdout
+		cmd.Stderr = c.stderr
+		return cmd.Run()
+	})
+	if err != nil {
+		return notCreatedError{fmt.Errorf("executing command: %w", err)}
+	}
+
+	return c.progress.runStep("", "Storing cluster config", func() error {
+		return c.storeConfig(ctx, configBytes, o.labels)
+	})
+}
+
+// notCreatedError wraps errors returned by Create before 'kind create cluster'
+// succeeded, i.e. when there is no cluster (of ours) to clean up.
+type notCreatedError struct {
+	error
+}
+
+func (e notCreatedError) Unwrap() error {
+	return e.error
+}
+
+// IsNotCreated returns true if err was returned by Create before the cluster
+// itself was created.
+func IsNotCreated(err error) bool {
+	var notCreated notCreatedError
+	return errors.As(err, &notCreated)
+}
+
+// storeConfig stores the config of a newly created cluster in the cluster
+// itself, so that it can be loaded again by NewCluster.
+func (c *Cluster) storeConfig(ctx context.Context, configBytes []byte, labels map[string]string) error {
+	runtimeBytes, err := yaml.Marshal(c.runtime)
 	if err != nil {
 		return fmt.Errorf("marshaling YAML: %w", err)
 	}
 
-	cmd := exec.Command(command[0], command[1:]...)
-	cmd.Stdin = bytes.NewBuffer(configBytes)
-	cmd.Stdout = c.stdout
-	cmd.Stderr = c.stderr
+	// Record how the toolkit is to be installed up front so that provisioning
+	// can be resumed the same way
+	toolkitBytes, err := yaml.Marshal(c.newContainerToolkitRecord())
+	if err != nil {
+		return fmt.Errorf("marshaling YAML: %w", err)
+	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("executing command: %w", err)
+	metadata, err := c.newClusterMetadata()
+	if err != nil {
+		return fmt.Errorf("getting cluster metadata: %w", err)
 	}
 
-	if err := addConfigBytesToExistingCluster(c.Name, configBytes); err != nil {
+	metadataBytes, err := yaml.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("marshaling YAML: %w", err)
+	}
+
+	cdiDevicesBytes, err := yaml.Marshal(c.cdiDevices)
+	if err != nil {
+		return fmt.Errorf("marshaling YAML: %w", err)
+	}
+
+	data := map[string]string{
+		nvkindClusterConfigSchemaVersionKey: strconv.Itoa(nvkindClusterConfigSchemaVersion),
+		nvkindClusterConfigKey:              string(configBytes),
+		nvkindClusterConfigTemplateKey:      string(c.configTemplate),
+		nvkindClusterConfigValuesKey:        string(c.configValues),
+		nvkindClusterConfigMetadataKey:      string(metadataBytes),
+		nvkindClusterConfigRuntimeKey:       string(runtimeBytes),
+		nvkindClusterConfigCDIDevicesKey:    string(cdiDevicesBytes),
+		nvkindClusterConfigToolkitKey:       string(toolkitBytes),
+	}
+
+	if err := addConfigMapToExistingCluster(ctx, c.Name, data, labels); err != nil {
 		return fmt.Errorf("adding config to cluster: %w", err)
 	}
 
 	return nil
 }
 
-func (c *Cluster) Delete() error {
+// EnsureRuntimeClass creates the nvidia RuntimeClass in the cluster if it does
+// not exist yet. This is how pods select the nvidia runtime when it is not set
+// as the default runtime of containerd on the GPU workers.
+func (c *Cluster) EnsureRuntimeClass(ctx context.Context) error {
+	clientset, err := newClientsetForCluster(c.Name)
+	if err != nil {
+		return fmt.Errorf("getting clientset: %w", err)
+	}
+
+	runtimeClass := &nodev1.RuntimeClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nvidiaRuntimeName,
+		},
+		Handler: nvidiaRuntimeName,
+	}
+
+	_, err = clientset.NodeV1().RuntimeClasses().Create(ctx, runtimeClass, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating runtimeclass: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Cluster) Delete(ctx context.Context) error {
 	command := []string{
 		"kind", "delete", "cluster",
 		"--name", c.Name,
 	}
 
-	cmd := exec.Command(command[0], command[1:]...)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
 	cmd.Stdout = c.stdout
 	cmd.Stderr = c.stderr
 
@@ -140,13 +282,13 @@ func (c *Cluster) Delete() error {
 	return nil
 }
 
-func (c *Cluster) GetNodes() ([]Node, error) {
+func (c *Cluster) GetNodes(ctx context.Context) ([]Node, error) {
 	command := []string{
 		"kind", "get", "nodes",
 		"--name", c.Name,
 	}
 
-	cmd := exec.Command(command[0], command[1:]...)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("executing command: %w", err)
@@ -169,14 +311,10 @@ func (c *Cluster) GetNodes() ([]Node, error) {
 		return nil, fmt.Errorf("unable to determine node role from name: %v", node)
 	}
 
-	nodeConfigs := make(map[kind.NodeRole][]*kind.Node)
-	for _, node := range c.config.Nodes {
-		if node.Role == kind.ControlPlaneRole {
-			nodeConfigs[node.Role] = append(nodeConfigs[node.Role], &node)
-			continue
-		}
-		if node.Role == kind.WorkerRole {
-			nodeConfigs[node.Role] = append(nodeConfigs[node.Role], &node)
+	nodeConfigs := make(map[kind.NodeRole][]int)
+	for i, node := range c.config.Nodes {
+		if node.Role == kind.ControlPlaneRole || node.Role == kind.WorkerRole {
+			nodeConfigs[node.Role] = append(nodeConfigs[node.Role], i)
 			continue
 		}
 		return nil, fmt.Errorf("unknown node role: %v", node.Role)
@@ -189,12 +327,17 @@ func (c *Cluster) GetNodes() ([]Node, error) {
 		}
 
 		for i := range nodeNames[role] {
+			index := nodeConfigs[role][i]
 			node := Node{
-				Name:   nodeNames[role][i],
-				config: nodeConfigs[role][i].DeepCopy(),
-				nvml:   c.nvml,
-				stdout: c.stdout,
-				stderr: c.stderr,
+				Name:       nodeNames[role][i],
+				config:     c.config.Nodes[index].DeepCopy(),
+				nvml:       c.nvml,
+				stdout:     c.stdout,
+				stderr:     c.stderr,
+				progress:   c.progress,
+				toolkit:    c.toolkit,
+				runtime:    c.runtime,
+				cdiDevices: c.cdiDevices.forNode(index),
 			}
 			nodes = append(nodes, node)
 		}
@@ -203,8 +346,68 @@ func (c *Cluster) GetNodes() ([]Node, error) {
 	return nodes, nil
 }
 
-func (o *ClusterOptions) setConfig() error {
-	existingClusters, err := GetClusterNames()
+// RecordContainerToolkitVersions stores the version of the
+// nvidia-container-toolkit installed on each of the given nodes alongside the
+// config of the cluster.
+func (c *Cluster) RecordContainerToolkitVersions(ctx context.Context, nodes []Node) error {
+	record := c.newContainerToolkitRecord()
+
+	for _, node := range nodes {
+		if !node.HasGPUs() {
+			continue
+		}
+		version, err := node.GetContainerToolkitVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("getting container toolkit version on node '%v': %w", node.Name, err)
+		}
+		record.Installed[node.Name] = version
+	}
+
+	return c.setContainerToolkitRecord(ctx, record)
+}
+
+func (c *Cluster) newContainerToolkitRecord() containerToolkitRecord {
+	return containerToolkitRecord{
+		Channel:   c.toolkit.channel,
+		Version:   c.toolkit.version,
+		Packages:  c.toolkit.packagesDir,
+		AptMirror: c.toolkit.aptMirrorDir,
+		Installed: make(map[string]string),
+	}
+}
+
+func (c *Cluster) setContainerToolkitRecord(ctx context.Context, record containerToolkitRecord) error {
+	recordBytes, err := yaml.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshaling YAML: %w", err)
+	}
+
+	if err := updateConfigMapOfExistingCluster(ctx, c.Name, nvkindClusterConfigToolkitKey, string(recordBytes)); err != nil {
+		return fmt.Errorf("updating configmap: %w", err)
+	}
+
+	return nil
+}
+
+// GetContainerToolkitVersions returns the versions of the
+// nvidia-container-toolkit recorded for each node of the cluster at the time
+// it was created.
+func (c *Cluster) GetContainerToolkitVersions(ctx context.Context) (map[string]string, error) {
+	data, err := getConfigMapDataFromExistingCluster(ctx, c.Name)
+	if err != nil {
+		return nil, fmt.Errorf("getting configmap data: %w", err)
+	}
+
+	var record containerToolkitRecord
+	if err := yaml.Unmarshal([]byte(data[nvkindClusterConfigToolkitKey]), &record); err != nil {
+		return nil, fmt.Errorf("unmarshaling YAML: %w", err)
+	}
+
+	return record.Installed, nil
+}
+
+func (o *ClusterOptions) setConfig(ctx context.Context) error {
+	existingClusters, err := GetClusterNames(ctx)
 	if err != nil {
 		return fmt.Errorf("getting list of existing clusters: %w", err)
 	}
@@ -219,10 +422,11 @@ func (o *ClusterOptions) setConfig() error {
 
 	var options []ConfigOption
 	if existingClusters.Has(o.name) {
-		existingConfigBytes, err := getConfigBytesFromExistingCluster(o.name)
+		existingData, err := getConfigMapDataFromExistingCluster(ctx, o.name)
 		if err != nil {
-			return fmt.Errorf("getting config bytes: %w", err)
+			return fmt.Errorf("getting configmap data: %w", err)
 		}
+		existingConfigBytes := []byte(existingData[nvkindClusterConfigKey])
 		if o.config != nil {
 			var existingConfig kind.Cluster
 			if err := yaml.Unmarshal(existingConfigBytes, &existingConfig); err != nil {
@@ -234,8 +438,32 @@ func (o *ClusterOptions) setConfig() error {
 			return nil
 		}
 		options = append(options, WithConfigTemplate(existingConfigBytes))
+
+		var runtime ContainerRuntimeConfig
+		if err := yaml.Unmarshal([]byte(existingData[nvkindClusterConfigRuntimeKey]), &runtime); err != nil {
+			return fmt.Errorf("unmarshaling YAML: %w", err)
+		}
+		options = append(options, WithContainerRuntimeConfig(runtime))
+
+		var cdiDevices cdiDeviceRequests
+		if err := yaml.Unmarshal([]byte(existingData[nvkindClusterConfigCDIDevicesKey]), &cdiDevices); err != nil {
+			return fmt.Errorf("unmarshaling YAML: %w", err)
+		}
+		options = append(options, func(o *ConfigOptions) {
+			o.cdiDevices = cdiDevices
+		})
+
+		if toolkitData, exists := existingData[nvkindClusterConfigToolkitKey]; exists {
+			var record containerToolkitRecord
+			if err := yaml.Unmarshal([]byte(toolkitData), &record); err != nil {
+				return fmt.Errorf("unmarshaling YAML: %w", err)
+			}
+			options = append(options, record.configOptions()...)
+		}
 	}
 
+	options = append(options, o.configOptions...)
+
 	config, err := NewConfig(options...)
 	if err != nil {
 		return fmt.Errorf("creating new config: %w", err)
@@ -245,58 +473,112 @@ func (o *ClusterOptions) setConfig() error {
 	return nil
 }
 
-func addConfigBytesToExistingCluster(name string, configBytes []byte) error {
+func newClientsetForCluster(name string) (kubernetes.Interface, error) {
 	rules := clientcmd.NewDefaultClientConfigLoadingRules()
 	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: "kind-" + name}
 	loadingConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, configOverrides)
 	csconfig, err := loadingConfig.ClientConfig()
 	if err != nil {
-		return fmt.Errorf("loading client config: %w", err)
+		return nil, fmt.Errorf("loading client config: %w", err)
 	}
 
 	clientset, err := kubernetes.NewForConfig(csconfig)
 	if err != nil {
-		return fmt.Errorf("creating clientset: %w", err)
+		return nil, fmt.Errorf("creating clientset: %w", err)
 	}
 
-	configMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: nvkindClusterConfigName,
-		},
-		Data: map[string]string{
-			"config": string(configBytes),
-		},
+	return clientset, nil
+}
+
+func addConfigMapToExistingCluster(ctx context.Context, name string, data, labels map[string]string) error {
+	clientset, err := newClientsetForCluster(name)
+	if err != nil {
+		return fmt.Errorf("getting clientset: %w", err)
+	}
+
+	if err := ensureNvkindNamespace(ctx, clientset); err != nil {
+		return fmt.Errorf("creating namespace: %w", err)
 	}
 
+	configMap := newClusterConfigMap(data, labels)
+
 	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		_, err := clientset.CoreV1().ConfigMaps("default").Create(context.Background(), configMap, metav1.CreateOptions{})
+		_, err := clientset.CoreV1().ConfigMaps(nvkindNamespace).Create(ctx, configMap, metav1.CreateOptions{})
 		return err
 	})
 	if retryErr != nil {
-		return fmt.Errorf("writing configmap: %w", err)
+		return fmt.Errorf("writing configmap: %w", retryErr)
 	}
 
 	return nil
 }
 
-func getConfigBytesFromExistingCluster(name string) ([]byte, error) {
-	rules := clientcmd.NewDefaultClientConfigLoadingRules()
-	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: "kind-" + name}
-	loadingConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, configOverrides)
-	csconfig, err := loadingConfig.ClientConfig()
+func updateConfigMapOfExistingCluster(ctx context.Context, name, key, value string) error {
+	clientset, err := newClientsetForCluster(name)
 	if err != nil {
-		return nil, fmt.Errorf("loading client config: %w", err)
+		return fmt.Errorf("getting clientset: %w", err)
 	}
 
-	clientset, err := kubernetes.NewForConfig(csconfig)
+	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := clientset.CoreV1().ConfigMaps(nvkindNamespace).Get(ctx, nvkindClusterConfigName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configMap, err = moveLegacyConfigMap(ctx, clientset)
+		}
+		if err != nil {
+			return err
+		}
+		configMap.Data, err = migrateClusterConfigData(configMap.Data)
+		if err != nil {
+			return fmt.Errorf("migrating config: %w", err)
+		}
+		configMap.Data[key] = value
+		_, err = clientset.CoreV1().ConfigMaps(nvkindNamespace).Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+	if retryErr != nil {
+		return fmt.Errorf("writing configmap: %w", retryErr)
+	}
+
+	return nil
+}
+
+func getConfigMapDataFromExistingCluster(ctx context.Context, name string) (map[string]string, error) {
+	configMap, err := getConfigMapFromExistingCluster(ctx, name)
 	if err != nil {
-		return nil, fmt.Errorf("creating clientset: %w", err)
+		return nil, err
 	}
+	return configMap.Data, nil
+}
 
-	configMap, err := clientset.CoreV1().ConfigMaps("default").Get(context.Background(), nvkindClusterConfigName, metav1.GetOptions{})
+// getConfigMapFromExistingCluster returns the ConfigMap nvkind stored in the
+// cluster, with its data migrated to the latest schema version. The ConfigMap
+// itself is only moved and rewritten the next time it is updated.
+func getConfigMapFromExistingCluster(ctx context.Context, name string) (*corev1.ConfigMap, error) {
+	clientset, err := newClientsetForCluster(name)
+	if err != nil {
+		return nil, fmt.Errorf("getting clientset: %w", err)
+	}
+
+	configMap, err := clientset.CoreV1().ConfigMaps(nvkindNamespace).Get(ctx, nvkindClusterConfigName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap, err = clientset.CoreV1().ConfigMaps(nvkindLegacyNamespace).Get(ctx, nvkindClusterConfigName, metav1.GetOptions{})
+	}
 	if err != nil {
 		return nil, fmt.Errorf("getting configmap: %w", err)
 	}
 
-	return []byte(configMap.Data["config"]), nil
+	configMap.Data, err = migrateClusterConfigData(configMap.Data)
+	if err != nil {
+		return nil, fmt.Errorf("migrating config: %w", err)
+	}
+
+	return configMap, nil
+}
+
+func getConfigBytesFromExistingCluster(ctx context.Context, name string) ([]byte, error) {
+	data, err := getConfigMapDataFromExistingCluster(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(data[nvkindClusterConfigKey]), nil
 }
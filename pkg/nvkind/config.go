@@ -20,31 +20,33 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"text/template"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/NVIDIA/go-nvlib/pkg/nvml"
+	"github.com/go-logr/logr"
 	"gopkg.in/yaml.v2"
 	"k8s.io/apimachinery/pkg/util/rand"
 	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
 )
 
+const (
+	defaultToolkitChannel = "experimental"
+)
+
+var defaultContainerRuntimeConfig = ContainerRuntimeConfig{
+	SetAsDefault: true,
+}
+
 func NewConfig(opts ...ConfigOption) (*Config, error) {
 	o := ConfigOptions{}
 	for _, opt := range opts {
 		opt(&o)
 	}
-	if o.defaultName == "" {
-		o.defaultName = fmt.Sprintf("nvkind-%s", rand.String(5))
-	}
-	if o.nvml == nil {
-		o.nvml = nvml.New()
-	}
-	if o.stdout == nil {
-		o.stdout = os.Stdout
-	}
-	if o.stderr == nil {
-		o.stderr = os.Stderr
+	if err := o.setDefaults(); err != nil {
+		return nil, err
 	}
 	if o.configTemplate == nil && o.configTemplatePath == "" {
 		o.configTemplate = defaultConfigTemplate
@@ -78,6 +80,14 @@ func NewConfig(opts ...ConfigOption) (*Config, error) {
 	}
 	values = convertToMap(values)
 
+	if o.runtime == nil {
+		runtime, err := getContainerRuntimeConfig(values)
+		if err != nil {
+			return nil, fmt.Errorf("getting container runtime config from values: %w", err)
+		}
+		o.runtime = runtime
+	}
+
 	var buffer bytes.Buffer
 	if err := tmpl.Execute(&buffer, values); err != nil {
 		return nil, fmt.Errorf("executing template: %w", err)
@@ -92,25 +102,99 @@ func NewConfig(opts ...ConfigOption) (*Config, error) {
 		cluster.Name = o.defaultName
 	}
 
+	if o.cdiDevices == nil {
+		o.cdiDevices, err = getCDIDeviceRequests(buffer.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("getting CDI devices: %w", err)
+		}
+	}
+
 	if o.image != "" {
 		for i := range cluster.Nodes {
 			cluster.Nodes[i].Image = o.image
 		}
 	}
 
+	if err := resolvePCIBusIDs(&cluster, o.nvml); err != nil {
+		return nil, fmt.Errorf("resolving PCI bus IDs: %w", err)
+	}
+
+	if err := resolveMigDeviceIndices(&cluster, o.nvml); err != nil {
+		return nil, fmt.Errorf("resolving MIG device indices: %w", err)
+	}
+
+	if err := resolveCDIDevices(&cluster, o.cdiDevices); err != nil {
+		return nil, fmt.Errorf("resolving CDI devices: %w", err)
+	}
+
+	addContainerdConfigPatches(&cluster, *o.runtime)
+
 	config := &Config{
 		Cluster: &cluster,
 		nvml:    o.nvml,
 		stdout:  o.stdout,
 		stderr:  o.stderr,
+		progress: progressReporter{
+			logger:  *o.logger,
+			handler: o.progressHandler,
+		},
+		allowSharedGPUs: o.allowSharedGPUs,
+		toolkit:         o.toolkit,
+		runtime:         *o.runtime,
+		cdiDevices:      o.cdiDevices,
+		configTemplate:  o.configTemplate,
+		configValues:    o.configValues,
 	}
 
 	return config, nil
 }
 
+// setDefaults sets the options that do not depend on the config template or
+// values to their defaults if they are not set.
+func (o *ConfigOptions) setDefaults() error {
+	if o.defaultName == "" {
+		o.defaultName = fmt.Sprintf("nvkind-%s", rand.String(5))
+	}
+	if o.nvml == nil {
+		o.nvml = nvml.New()
+	}
+	if o.stdout == nil {
+		o.stdout = os.Stdout
+	}
+	if o.stderr == nil {
+		o.stderr = os.Stderr
+	}
+	if o.logger == nil {
+		logger := logr.Discard()
+		o.logger = &logger
+	}
+	if o.toolkit.channel == "" {
+		o.toolkit.channel = defaultToolkitChannel
+	}
+	if o.toolkit.channel != "stable" && o.toolkit.channel != "experimental" {
+		return fmt.Errorf("unknown container toolkit channel: %v", o.toolkit.channel)
+	}
+	if o.toolkit.packagesDir != "" && o.toolkit.aptMirrorDir != "" {
+		return fmt.Errorf("cannot install the container toolkit from both a packages directory and an apt mirror")
+	}
+	if o.toolkit.packagesDir != "" && o.toolkit.version != "" {
+		return fmt.Errorf("cannot pin the container toolkit version when installing from a packages directory")
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	return validateConfig(c.Cluster, c.cdiDevices, c.nvml, c.allowSharedGPUs)
+}
+
 func (o *ConfigOptions) buildFuncMap() template.FuncMap {
 	funcmap := map[string]any{
-		"numGPUs": o.numGPUs,
+		"numGPUs":        o.numGPUs,
+		"gpus":           o.gpus,
+		"gpusWhere":      o.gpusWhere,
+		"gpusByNUMANode": o.gpusByNUMANode,
+		"gpusByNVLink":   o.gpusByNVLink,
+		"gpuPartitions":  o.gpuPartitions,
 	}
 	for k, v := range o.extraFuncMap {
 		funcmap[k] = v
@@ -135,6 +219,207 @@ func (o *ConfigOptions) numGPUs() (int, error) {
 	return numGPUs, nil
 }
 
+// getContainerRuntimeConfig returns the container runtime config set under
+// the containerRuntime key of the given values, with any fields not set there
+// taking their default values.
+func getContainerRuntimeConfig(values any) (*ContainerRuntimeConfig, error) {
+	runtime := defaultContainerRuntimeConfig
+
+	valuesMap, ok := values.(map[string]any)
+	if !ok || valuesMap["containerRuntime"] == nil {
+		return &runtime, nil
+	}
+
+	runtimeBytes, err := yaml.Marshal(valuesMap["containerRuntime"])
+	if err != nil {
+		return nil, fmt.Errorf("marshaling YAML: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(runtimeBytes, &runtime); err != nil {
+		return nil, fmt.Errorf("unmarshaling YAML: %w", err)
+	}
+
+	return &runtime, nil
+}
+
+// getNodeNames returns the names kind will give to each node of a cluster,
+// in the order the nodes appear in its config.
+func getNodeNames(cluster *kind.Cluster) []string {
+	counts := make(map[kind.NodeRole]int)
+	names := make([]string, 0, len(cluster.Nodes))
+	for _, node := range cluster.Nodes {
+		counts[node.Role]++
+		name := fmt.Sprintf("%s-%s", cluster.Name, node.Role)
+		if counts[node.Role] > 1 {
+			name = fmt.Sprintf("%s%d", name, counts[node.Role])
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// resolvePCIBusIDs replaces any devices referenced by their PCI bus ID with
+// the UUID of the corresponding host GPU. PCI bus IDs are neither understood by
+// the nvidia-container-runtime nor valid in the container path of a volume
+// mount, but they are often the most stable way to refer to a GPU on a host.
+func resolvePCIBusIDs(cluster *kind.Cluster, nvmllib nvml.Interface) error {
+	var gpus []HostGPU
+	for i := range cluster.Nodes {
+		for j := range cluster.Nodes[i].ExtraMounts {
+			mount := &cluster.Nodes[i].ExtraMounts[j]
+			if mount.HostPath != "/dev/null" {
+				continue
+			}
+
+			pciBusID, valid := parsePCIBusID(getNvidiaVisibleDevice(mount.ContainerPath))
+			if !valid {
+				continue
+			}
+
+			if gpus == nil {
+				var err error
+				gpus, err = getHostGPUs(nvmllib)
+				if err != nil {
+					return fmt.Errorf("getting host GPUs: %w", err)
+				}
+			}
+
+			var uuid string
+			for _, gpu := range gpus {
+				if gpu.PCIBusID == pciBusID {
+					uuid = gpu.UUID
+					break
+				}
+			}
+			if uuid == "" {
+				return fmt.Errorf("no GPU found with PCI bus ID: %v", pciBusID)
+			}
+
+			mount.ContainerPath = filepath.Join(nvidiaContainerDevicesRoot, uuid)
+		}
+	}
+
+	return nil
+}
+
+// resolveMigDeviceIndices replaces any MIG devices referenced as
+// <gpu index>:<mig index> in the container path of a volume mount, where a ':'
+// is not valid, with the UUID of the corresponding MIG device.
+func resolveMigDeviceIndices(cluster *kind.Cluster, nvmllib nvml.Interface) error {
+	var gpus []HostGPU
+	for i := range cluster.Nodes {
+		for j := range cluster.Nodes[i].ExtraMounts {
+			mount := &cluster.Nodes[i].ExtraMounts[j]
+			if mount.HostPath != "/dev/null" {
+				continue
+			}
+
+			id := getNvidiaVisibleDevice(mount.ContainerPath)
+			if !migDeviceIndexRegexp.MatchString(id) {
+				continue
+			}
+
+			if gpus == nil {
+				var err error
+				gpus, err = getHostGPUs(nvmllib)
+				if err != nil {
+					return fmt.Errorf("getting host GPUs: %w", err)
+				}
+			}
+
+			_, mig, found := resolveDevice(gpus, id)
+			if !found || mig == nil {
+				return fmt.Errorf("no MIG device found with index: %v", id)
+			}
+
+			mount.ContainerPath = filepath.Join(nvidiaContainerDevicesRoot, mig.UUID)
+		}
+	}
+
+	return nil
+}
+
+func (o *ConfigOptions) gpus() ([]any, error) {
+	gpus, err := getHostGPUsWithTopology(o.nvml)
+	if err != nil {
+		return nil, fmt.Errorf("getting host GPUs: %w", err)
+	}
+	return gpusTemplateValue(gpus), nil
+}
+
+func (o *ConfigOptions) gpusByNUMANode() ([]any, error) {
+	gpus, err := getHostGPUsWithTopology(o.nvml)
+	if err != nil {
+		return nil, fmt.Errorf("getting host GPUs: %w", err)
+	}
+	return gpuGroupsTemplateValue(GroupHostGPUsByNUMANode(gpus)), nil
+}
+
+func (o *ConfigOptions) gpusByNVLink() ([]any, error) {
+	gpus, err := getHostGPUsWithTopology(o.nvml)
+	if err != nil {
+		return nil, fmt.Errorf("getting host GPUs: %w", err)
+	}
+	return gpuGroupsTemplateValue(GroupHostGPUsByNVLink(gpus)), nil
+}
+
+func (o *ConfigOptions) gpuPartitions(n int) ([]any, error) {
+	gpus, err := getHostGPUsWithTopology(o.nvml)
+	if err != nil {
+		return nil, fmt.Errorf("getting host GPUs: %w", err)
+	}
+	partitions, err := PartitionHostGPUs(gpus, n)
+	if err != nil {
+		return nil, fmt.Errorf("partitioning GPUs: %w", err)
+	}
+	return gpuGroupsTemplateValue(partitions), nil
+}
+
+func gpusTemplateValue(gpus []HostGPU) []any {
+	values := make([]any, 0, len(gpus))
+	for _, gpu := range gpus {
+		values = append(values, gpu.templateValue())
+	}
+	return values
+}
+
+func gpuGroupsTemplateValue(groups [][]HostGPU) []any {
+	values := make([]any, 0, len(groups))
+	for _, group := range groups {
+		values = append(values, gpusTemplateValue(group))
+	}
+	return values
+}
+
+// gpusWhere returns the subset of GPUs whose value for the given key matches
+// the given value. String values match if they contain the given value (e.g.
+// `gpusWhere "name" "H100"`), all other values must be equal.
+func (o *ConfigOptions) gpusWhere(key string, value any) ([]any, error) {
+	gpus, err := o.gpus()
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []any
+	for _, gpu := range gpus {
+		//nolint:forcetypeassert
+		v, exists := gpu.(map[string]any)[key]
+		if !exists {
+			return nil, fmt.Errorf("unknown GPU attribute: %v", key)
+		}
+		if s, ok := v.(string); ok {
+			if strings.Contains(s, fmt.Sprint(value)) {
+				matching = append(matching, gpu)
+			}
+			continue
+		}
+		if fmt.Sprint(v) == fmt.Sprint(value) {
+			matching = append(matching, gpu)
+		}
+	}
+
+	return matching, nil
+}
+
 func convertToMap(data any) any {
 	switch v := data.(type) {
 	case map[any]any:
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"fmt"
+	"slices"
+
+	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+const (
+	nvidiaContainerRuntimePath = "/usr/bin/nvidia-container-runtime"
+)
+
+// The runc options of the nvidia runtime handler mirror those of the runc
+// handler in the containerd config of the kind node images.
+var nvidiaRuntimeHandlerPatch = fmt.Sprintf(`[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.%[1]s]
+  runtime_type = "io.containerd.runc.v2"
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.%[1]s.options]
+    BinaryName = %[2]q
+    SystemdCgroup = true
+`, nvidiaRuntimeName, nvidiaContainerRuntimePath)
+
+var cdiPatch = `[plugins."io.containerd.grpc.v1.cri"]
+  enable_cdi = true
+  cdi_spec_dirs = ["/etc/cdi", "/var/run/cdi"]
+`
+
+// addContainerdConfigPatches adds the containerd config needed to run
+// containers with the nvidia runtime to the cluster, unless already present.
+func addContainerdConfigPatches(cluster *kind.Cluster, runtime ContainerRuntimeConfig) {
+	patches := []string{nvidiaRuntimeHandlerPatch}
+	if runtime.CDIEnabled {
+		patches = append(patches, cdiPatch)
+	}
+
+	for _, patch := range patches {
+		if !slices.Contains(cluster.ContainerdConfigPatches, patch) {
+			cluster.ContainerdConfigPatches = append(cluster.ContainerdConfigPatches, patch)
+		}
+	}
+}
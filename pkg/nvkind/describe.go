@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"context"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Describe returns the config the cluster was created with along with the
+// current state of each of its nodes. The devices of each node are those
+// recorded when the cluster was created, marked if they no longer match the
+// host.
+func (c *Cluster) Describe(ctx context.Context) (*ClusterDescription, error) {
+	data, err := getConfigMapDataFromExistingCluster(ctx, c.Name)
+	if err != nil {
+		return nil, fmt.Errorf("getting configmap data: %w", err)
+	}
+
+	var toolkit containerToolkitRecord
+	if err := yaml.Unmarshal([]byte(data[nvkindClusterConfigToolkitKey]), &toolkit); err != nil {
+		return nil, fmt.Errorf("unmarshaling YAML: %w", err)
+	}
+
+	provisioning := make(map[string]NodeProvisioningState)
+	if err := yaml.Unmarshal([]byte(data[nvkindClusterConfigProvisioningKey]), &provisioning); err != nil {
+		return nil, fmt.Errorf("unmarshaling YAML: %w", err)
+	}
+
+	metadata, err := getClusterMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("getting cluster metadata: %w", err)
+	}
+
+	gpus, err := getHostGPUs(c.nvml)
+	if err != nil {
+		return nil, fmt.Errorf("getting host GPUs: %w", err)
+	}
+	drifts := checkDeviceAssignments(metadata.Devices, gpus)
+
+	nodes, err := c.GetNodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting nodes: %w", err)
+	}
+
+	description := &ClusterDescription{
+		Name:                    c.Name,
+		KubeContext:             "kind-" + c.Name,
+		ContainerRuntime:        c.runtime,
+		ContainerToolkitChannel: toolkit.Channel,
+		ContainerToolkitVersion: toolkit.Version,
+		Config:                  data[nvkindClusterConfigKey],
+	}
+	if !metadata.CreationTimestamp.IsZero() {
+		description.NvkindVersion = metadata.NvkindVersion
+		description.Created = &metadata.CreationTimestamp
+	}
+
+	for _, node := range nodes {
+		nodeDescription, err := node.describe(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describing node '%v': %w", node.Name, err)
+		}
+		for _, assignment := range metadata.Devices {
+			if assignment.Node != node.Name {
+				continue
+			}
+			device := DeviceDescription{DeviceAssignment: assignment}
+			for _, drift := range drifts {
+				if drift.Node == assignment.Node && drift.Device == assignment.Device && drift.RecordedUUID == assignment.UUID {
+					device.Drift = drift.Message
+				}
+			}
+			nodeDescription.Devices = append(nodeDescription.Devices, device)
+		}
+		if node.HasGPUs() {
+			state := provisioning[node.Name]
+			nodeDescription.ToolkitVersion = toolkit.Installed[node.Name]
+			nodeDescription.Provisioning = &state
+			if c.runtime.SetAsDefault && state.RuntimeConfigured {
+				nodeDescription.DefaultRuntime = nvidiaRuntimeName
+			}
+		}
+		description.Nodes = append(description.Nodes, *nodeDescription)
+	}
+
+	return description, nil
+}
+
+func (n *Node) describe(ctx context.Context) (*NodeDescription, error) {
+	image, err := n.GetImage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting image: %w", err)
+	}
+
+	description := &NodeDescription{
+		Name:           n.Name,
+		Role:           string(n.config.Role),
+		Image:          image,
+		DefaultRuntime: "runc",
+	}
+
+	if n.HasGPUs() {
+		description.ProcDriverPatched, err = n.IsProcDriverNvidiaPatched(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("checking /proc/driver/nvidia: %w", err)
+		}
+	}
+
+	return description, nil
+}
@@ -0,0 +1,434 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvml"
+)
+
+const (
+	nvidiaCapsMigMinorsPath = "/proc/driver/nvidia-caps/mig-minors"
+	sysBusPCIDevicesPath    = "/sys/bus/pci/devices"
+)
+
+var pciBusIDRegexp = regexp.MustCompile(`^(?:([0-9a-f]{1,8}):)?([0-9a-f]{1,2}):([0-9a-f]{1,2})\.([0-7])$`)
+
+var migDeviceIndexRegexp = regexp.MustCompile(`^[0-9]+:[0-9]+$`)
+
+func GetHostGPUs(nvmllib nvml.Interface) ([]HostGPU, error) {
+	if nvmllib == nil {
+		nvmllib = nvml.New()
+	}
+	return getHostGPUsWithTopology(nvmllib)
+}
+
+// getHostGPUsWithTopology returns the GPUs of the host along with their place
+// in its topology (their NUMA node and NVLink peers). The topology is only
+// needed to group GPUs, so it is kept out of getHostGPUs, which is relied on
+// by everything else (e.g. isolating the GPUs of a node).
+func getHostGPUsWithTopology(nvmllib nvml.Interface) ([]HostGPU, error) {
+	gpus, err := getHostGPUs(nvmllib)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret := nvmllib.Init(); ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("running nvml.Init: %w", ret)
+	}
+	defer func() { _ = nvmllib.Shutdown() }()
+
+	for i := range gpus {
+		gpu := &gpus[i]
+
+		device, ret := nvmllib.DeviceGetHandleByIndex(gpu.Index)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("running nvml.DeviceGetHandleByIndex(%d): %w", gpu.Index, ret)
+		}
+
+		gpu.NUMANode, err = getNUMANode(gpu.PCIBusID)
+		if err != nil {
+			return nil, fmt.Errorf("getting NUMA node of GPU %d: %w", gpu.Index, err)
+		}
+
+		gpu.NVLinkRemotes, err = getNVLinkRemotes(device)
+		if err != nil {
+			return nil, fmt.Errorf("getting NVLink remotes of GPU %d: %w", gpu.Index, err)
+		}
+	}
+
+	return gpus, nil
+}
+
+func getHostGPUs(nvmllib nvml.Interface) ([]HostGPU, error) {
+	if ret := nvmllib.Init(); ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("running nvml.Init: %w", ret)
+	}
+	defer func() { _ = nvmllib.Shutdown() }()
+
+	numGPUs, ret := nvmllib.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("running nvml.DeviceGetCount: %w", ret)
+	}
+
+	var migMinors map[string]int
+
+	gpus := make([]HostGPU, 0, numGPUs)
+	for i := 0; i < numGPUs; i++ {
+		device, ret := nvmllib.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("running nvml.DeviceGetHandleByIndex(%d): %w", i, ret)
+		}
+
+		gpu, err := newHostGPU(i, device)
+		if err != nil {
+			return nil, fmt.Errorf("getting info for GPU %d: %w", i, err)
+		}
+
+		if gpu.MigEnabled {
+			if migMinors == nil {
+				migMinors, err = getMigCapMinors()
+				if err != nil {
+					return nil, fmt.Errorf("getting MIG capability minors: %w", err)
+				}
+			}
+			gpu.MigDevices, err = getHostMigDevices(gpu, device, migMinors)
+			if err != nil {
+				return nil, fmt.Errorf("getting MIG devices for GPU %d: %w", i, err)
+			}
+		}
+
+		gpus = append(gpus, *gpu)
+	}
+
+	return gpus, nil
+}
+
+func newHostGPU(index int, device nvml.Device) (*HostGPU, error) {
+	deviceMinor, ret := device.GetMinorNumber()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("running nvml.Device.GetMinorNumber: %w", ret)
+	}
+
+	uuid, ret := device.GetUUID()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("running nvml.Device.GetUUID: %w", ret)
+	}
+
+	name, ret := device.GetName()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("running nvml.Device.GetName: %w", ret)
+	}
+
+	memory, ret := device.GetMemoryInfo()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("running nvml.Device.GetMemoryInfo: %w", ret)
+	}
+
+	major, minor, ret := device.GetCudaComputeCapability()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("running nvml.Device.GetCudaComputeCapability: %w", ret)
+	}
+
+	pciInfo, ret := device.GetPciInfo()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("running nvml.Device.GetPciInfo: %w", ret)
+	}
+
+	pciBusID, valid := parsePCIBusID(int8SliceToString(pciInfo.BusId[:]))
+	if !valid {
+		return nil, fmt.Errorf("unable to parse PCI bus ID: %v", int8SliceToString(pciInfo.BusId[:]))
+	}
+
+	migMode, _, ret := device.GetMigMode()
+	if ret != nvml.SUCCESS && ret != nvml.ERROR_NOT_SUPPORTED {
+		return nil, fmt.Errorf("running nvml.Device.GetMigMode: %w", ret)
+	}
+
+	gpu := &HostGPU{
+		Index:             index,
+		Minor:             deviceMinor,
+		UUID:              uuid,
+		Name:              name,
+		MemoryMiB:         memory.Total / (1024 * 1024),
+		ComputeCapability: fmt.Sprintf("%d.%d", major, minor),
+		PCIBusID:          pciBusID,
+		NUMANode:          -1,
+		MigEnabled:        migMode == nvml.DEVICE_MIG_ENABLE,
+	}
+
+	return gpu, nil
+}
+
+func getHostMigDevices(gpu *HostGPU, device nvml.Device, migMinors map[string]int) ([]HostMigDevice, error) {
+	maxMigDevices, ret := device.GetMaxMigDeviceCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("running nvml.Device.GetMaxMigDeviceCount: %w", ret)
+	}
+
+	var migDevices []HostMigDevice
+	for i := 0; i < maxMigDevices; i++ {
+		mig, ret := device.GetMigDeviceHandleByIndex(i)
+		if ret == nvml.ERROR_NOT_FOUND {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("running nvml.Device.GetMigDeviceHandleByIndex(%d): %w", i, ret)
+		}
+
+		uuid, ret := mig.GetUUID()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("running nvml.Device.GetUUID: %w", ret)
+		}
+
+		gi, ret := mig.GetGpuInstanceId()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("running nvml.Device.GetGpuInstanceId: %w", ret)
+		}
+
+		ci, ret := mig.GetComputeInstanceId()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("running nvml.Device.GetComputeInstanceId: %w", ret)
+		}
+
+		giCapPath := fmt.Sprintf("gpu%d/gi%d/access", gpu.Minor, gi)
+		giCapMinor, exists := migMinors[giCapPath]
+		if !exists {
+			return nil, fmt.Errorf("no capability minor found for %v", giCapPath)
+		}
+
+		ciCapPath := fmt.Sprintf("gpu%d/gi%d/ci%d/access", gpu.Minor, gi, ci)
+		ciCapMinor, exists := migMinors[ciCapPath]
+		if !exists {
+			return nil, fmt.Errorf("no capability minor found for %v", ciCapPath)
+		}
+
+		migDevice := HostMigDevice{
+			Index:      i,
+			UUID:       uuid,
+			GIID:       gi,
+			CIID:       ci,
+			GICapMinor: giCapMinor,
+			CICapMinor: ciCapMinor,
+		}
+		migDevices = append(migDevices, migDevice)
+	}
+
+	return migDevices, nil
+}
+
+// getNVLinkRemotes returns the PCI bus IDs of the devices (GPUs or NVSwitches)
+// at the other end of each of the active NVLinks of a GPU.
+func getNVLinkRemotes(device nvml.Device) ([]string, error) {
+	var remotes []string
+	for link := 0; link < nvml.NVLINK_MAX_LINKS; link++ {
+		state, ret := device.GetNvLinkState(link)
+		if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_INVALID_ARGUMENT {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("running nvml.Device.GetNvLinkState(%d): %w", link, ret)
+		}
+		if state != nvml.FEATURE_ENABLED {
+			continue
+		}
+
+		pciInfo, ret := device.GetNvLinkRemotePciInfo(link)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("running nvml.Device.GetNvLinkRemotePciInfo(%d): %w", link, ret)
+		}
+
+		remote, valid := parsePCIBusID(int8SliceToString(pciInfo.BusId[:]))
+		if !valid {
+			return nil, fmt.Errorf("unable to parse PCI bus ID: %v", int8SliceToString(pciInfo.BusId[:]))
+		}
+		if !slices.Contains(remotes, remote) {
+			remotes = append(remotes, remote)
+		}
+	}
+
+	return remotes, nil
+}
+
+// getNUMANode returns the NUMA node the PCI device with the given bus ID is
+// attached to, or -1 if the system does not report one.
+func getNUMANode(pciBusID string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(sysBusPCIDevicesPath, pciBusID, "numa_node"))
+	if os.IsNotExist(err) {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("reading file: %w", err)
+	}
+
+	numaNode, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return -1, fmt.Errorf("parsing NUMA node: %w", err)
+	}
+
+	return numaNode, nil
+}
+
+// getMigCapMinors parses the mapping of MIG capability paths (e.g.
+// gpu0/gi1/ci0/access) to the minor numbers of their /dev/nvidia-caps device
+// nodes.
+func getMigCapMinors() (map[string]int, error) {
+	file, err := os.Open(nvidiaCapsMigMinorsPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	minors := make(map[string]int)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		minor, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("parsing minor for %v: %w", fields[0], err)
+		}
+		minors[fields[0]] = minor
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+
+	return minors, nil
+}
+
+// templateValue returns a representation of the GPU suitable for use in a
+// config template. Keys use lower camel case to match values files.
+func (g *HostGPU) templateValue() map[string]any {
+	migDevices := make([]any, 0, len(g.MigDevices))
+	for _, mig := range g.MigDevices {
+		migDevice := map[string]any{
+			"index": mig.Index,
+			"uuid":  mig.UUID,
+		}
+		migDevices = append(migDevices, migDevice)
+	}
+
+	return map[string]any{
+		"index":             g.Index,
+		"uuid":              g.UUID,
+		"name":              g.Name,
+		"memory":            g.MemoryMiB,
+		"computeCapability": g.ComputeCapability,
+		"pciBusID":          g.PCIBusID,
+		"numaNode":          g.NUMANode,
+		"migEnabled":        g.MigEnabled,
+		"migDevices":        migDevices,
+	}
+}
+
+// resolveDevice returns the host GPU or MIG device (along with its parent GPU)
+// that the given device ID refers to.
+func resolveDevice(gpus []HostGPU, id string) (*HostGPU, *HostMigDevice, bool) {
+	for i := range gpus {
+		gpu := &gpus[i]
+		if slices.Contains(gpu.visibleIDs(), id) {
+			return gpu, nil, true
+		}
+		for j := range gpu.MigDevices {
+			mig := &gpu.MigDevices[j]
+			if slices.Contains(mig.visibleIDs(gpu), id) {
+				return gpu, mig, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// visibleIDs returns the set of identifiers that can be used to refer to a
+// full GPU in a list of visible devices.
+func (g *HostGPU) visibleIDs() []string {
+	return []string{
+		strconv.Itoa(g.Index),
+		g.UUID,
+		g.PCIBusID,
+	}
+}
+
+// visibleIDs returns the set of identifiers that can be used to refer to a
+// MIG device in a list of visible devices.
+func (m *HostMigDevice) visibleIDs(parent *HostGPU) []string {
+	return []string{
+		fmt.Sprintf("%d:%d", parent.Index, m.Index),
+		m.UUID,
+	}
+}
+
+func getHostCUDAVersion(nvmllib nvml.Interface) (string, error) {
+	if ret := nvmllib.Init(); ret != nvml.SUCCESS {
+		return "", fmt.Errorf("running nvml.Init: %w", ret)
+	}
+	defer func() { _ = nvmllib.Shutdown() }()
+
+	version, ret := nvmllib.SystemGetCudaDriverVersion()
+	if ret != nvml.SUCCESS {
+		return "", fmt.Errorf("running nvml.SystemGetCudaDriverVersion: %w", ret)
+	}
+
+	return fmt.Sprintf("%d.%d", version/1000, (version%1000)/10), nil
+}
+
+// parsePCIBusID parses a PCI bus ID in any of the forms accepted by
+// nvidia-smi (e.g. 00000000:3B:00.0, 0000:3b:00.0 or 3b:00.0) and returns it
+// in its canonical <domain>:<bus>:<device>.<function> form as used in sysfs.
+func parsePCIBusID(id string) (string, bool) {
+	matches := pciBusIDRegexp.FindStringSubmatch(strings.ToLower(id))
+	if matches == nil {
+		return "", false
+	}
+
+	var fields [4]uint64
+	for i, match := range matches[1:] {
+		if match == "" {
+			continue
+		}
+		field, err := strconv.ParseUint(match, 16, 32)
+		if err != nil {
+			return "", false
+		}
+		fields[i] = field
+	}
+
+	return fmt.Sprintf("%04x:%02x:%02x.%x", fields[0], fields[1], fields[2], fields[3]), true
+}
+
+func int8SliceToString(s []int8) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c == 0 {
+			break
+		}
+		b.WriteByte(byte(c))
+	}
+	return b.String()
+}
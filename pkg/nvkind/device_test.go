@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package nvkind
+
+import (
+	"testing"
+)
+
+func TestParsePCIBusID(t *testing.T) {
+	testCases := []struct {
+		description string
+		id          string
+		expected    string
+		expectedOk  bool
+	}{
+		{
+			description: "nvidia-smi form",
+			id:          "00000000:3B:00.0",
+			expected:    "0000:3b:00.0",
+			expectedOk:  true,
+		},
+		{
+			description: "sysfs form",
+			id:          "0000:3b:00.0",
+			expected:    "0000:3b:00.0",
+			expectedOk:  true,
+		},
+		{
+			description: "without domain",
+			id:          "3b:00.0",
+			expected:    "0000:3b:00.0",
+			expectedOk:  true,
+		},
+		{
+			description: "non-zero domain and function",
+			id:          "0001:B1:1f.7",
+			expected:    "0001:b1:1f.7",
+			expectedOk:  true,
+		},
+		{
+			description: "short fields",
+			id:          "0:3:0.1",
+			expected:    "0000:03:00.1",
+			expectedOk:  true,
+		},
+		{
+			description: "GPU index",
+			id:          "0",
+		},
+		{
+			description: "GPU UUID",
+			id:          "GPU-4cf8db2d-06c0-7d70-1a51-e59b25b2c16c",
+		},
+		{
+			description: "MIG device index",
+			id:          "0:1",
+		},
+		{
+			description: "invalid function",
+			id:          "0000:3b:00.8",
+		},
+		{
+			description: "domain too long",
+			id:          "000000000:3b:00.0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			pciBusID, ok := parsePCIBusID(tc.id)
+			if ok != tc.expectedOk {
+				t.Fatalf("expected ok to be %v, got %v", tc.expectedOk, ok)
+			}
+			if pciBusID != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, pciBusID)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+const (
+	nodeImageToolkitLabel = "nvkind.nvidia.com/container-toolkit-version"
+	nodeImageRuntimeLabel = "nvkind.nvidia.com/container-runtime"
+)
+
+func NewNodeImage(opts ...NodeImageOption) (*NodeImage, error) {
+	o := NodeImageOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.baseImage == "" {
+		return nil, fmt.Errorf("a base image is required")
+	}
+	if o.tag == "" {
+		return nil, fmt.Errorf("a tag is required")
+	}
+
+	co := ConfigOptions{}
+	for _, opt := range o.configOptions {
+		opt(&co)
+	}
+	if err := co.setDefaults(); err != nil {
+		return nil, err
+	}
+	if co.runtime == nil {
+		runtime := defaultContainerRuntimeConfig
+		co.runtime = &runtime
+	}
+
+	image := &NodeImage{
+		BaseImage: o.baseImage,
+		Tag:       o.tag,
+		toolkit:   co.toolkit,
+		runtime:   *co.runtime,
+		stdout:    co.stdout,
+		stderr:    co.stderr,
+		progress: progressReporter{
+			logger:  *co.logger,
+			handler: co.progressHandler,
+		},
+	}
+
+	return image, nil
+}
+
+// Build installs and configures the nvidia-container-toolkit in a container
+// started from the base image and commits the result under the image's tag.
+// Nodes booted from the resulting image skip these steps when provisioned.
+func (i *NodeImage) Build(ctx context.Context) error {
+	entrypoint, err := i.inspectBaseImage(ctx, "{{ json .Config.Entrypoint }}")
+	if err != nil {
+		return fmt.Errorf("getting entrypoint of base image: %w", err)
+	}
+
+	cmd, err := i.inspectBaseImage(ctx, "{{ json .Config.Cmd }}")
+	if err != nil {
+		return fmt.Errorf("getting cmd of base image: %w", err)
+	}
+	if cmd == "null" {
+		cmd = "[]"
+	}
+
+	container := fmt.Sprintf("nvkind-image-build-%s", rand.String(5))
+
+	// Keep the container alive without booting systemd, containerd, etc.
+	err = i.run(ctx, "docker", "run", "--detach", "--name", container, "--entrypoint", "sleep", i.BaseImage, "infinity")
+	if err != nil {
+		return fmt.Errorf("starting build container: %w", err)
+	}
+	// Clean up even if ctx was cancelled
+	defer func() { _ = i.run(context.WithoutCancel(ctx), "docker", "rm", "--force", container) }()
+
+	node := &Node{
+		Name:     container,
+		stdout:   i.stdout,
+		stderr:   i.stderr,
+		progress: i.progress,
+		toolkit:  i.toolkit,
+		runtime:  i.runtime,
+	}
+
+	err = i.progress.runStep("", "Installing container toolkit", func() error {
+		return node.InstallContainerToolkit(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("installing container toolkit: %w", err)
+	}
+
+	err = i.progress.runStep("", "Configuring container runtime", func() error {
+		if err := node.configureNvidiaContainerRuntime(ctx); err != nil {
+			return fmt.Errorf("configuring nvidia-container-runtime: %w", err)
+		}
+		return node.configureContainerd(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("configuring container runtime: %w", err)
+	}
+
+	version, err := node.GetContainerToolkitVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("getting container toolkit version: %w", err)
+	}
+
+	runtimeBytes, err := json.Marshal(i.runtime.nodeImageConfig())
+	if err != nil {
+		return fmt.Errorf("marshaling JSON: %w", err)
+	}
+
+	err = i.progress.runStep("", "Committing image", func() error {
+		return i.run(ctx, "docker", "commit",
+			"--change", "ENTRYPOINT "+entrypoint,
+			"--change", "CMD "+cmd,
+			"--change", fmt.Sprintf("LABEL %s=%s", nodeImageToolkitLabel, version),
+			"--change", fmt.Sprintf("LABEL %s=%s", nodeImageRuntimeLabel, strconv.Quote(string(runtimeBytes))),
+			container, i.Tag)
+	})
+	if err != nil {
+		return fmt.Errorf("committing image: %w", err)
+	}
+
+	return nil
+}
+
+// nodeImageConfig returns the part of the container runtime config that is
+// baked into images built by NodeImage.Build. CDI specs are always generated
+// when the node is provisioned, since they depend on the GPUs of the node.
+func (r ContainerRuntimeConfig) nodeImageConfig() ContainerRuntimeConfig {
+	config := r
+	config.GenerateCDISpec = false
+	if len(config.AnnotationPrefixes) == 0 {
+		config.AnnotationPrefixes = nil
+	}
+	return config
+}
+
+func (i *NodeImage) inspectBaseImage(ctx context.Context, format string) (string, error) {
+	command := []string{
+		"docker", "image", "inspect", "--format", format, i.BaseImage,
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("executing command: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (i *NodeImage) run(ctx context.Context, command ...string) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = i.stdout
+	cmd.Stderr = i.stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("executing command: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvml"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+const (
+	kindClusterLabel = "io.x-k8s.kind.cluster"
+	kindRoleLabel    = "io.x-k8s.kind.role"
+
+	listClustersAPITimeout = 5 * time.Second
+)
+
+var nvidiaGPUDeviceNodeRegexp = regexp.MustCompile(`^/dev/nvidia[0-9]+$`)
+
+// nodeContainer is the subset of the output of docker inspect for the
+// container of a kind node needed to summarize its cluster.
+type nodeContainer struct {
+	Name    string
+	Created time.Time
+	State   struct {
+		Running bool
+	}
+	Config struct {
+		Labels map[string]string
+	}
+	Mounts []struct {
+		Source      string
+		Destination string
+	}
+}
+
+// ListClusters returns a summary of each kind cluster, sorted by name,
+// including stopped clusters.
+func ListClusters(ctx context.Context, opts ...ListClustersOption) ([]ClusterSummary, error) {
+	o := ListClustersOptions{
+		selector: labels.Everything(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.nvml == nil {
+		o.nvml = nvml.New()
+	}
+
+	containers, err := getKindNodeContainers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting kind node containers: %w", err)
+	}
+
+	containersByCluster := make(map[string][]nodeContainer)
+	for _, container := range containers {
+		name := container.Config.Labels[kindClusterLabel]
+		containersByCluster[name] = append(containersByCluster[name], container)
+	}
+
+	names := make([]string, 0, len(containersByCluster))
+	for name := range containersByCluster {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var hostGPUs []HostGPU
+	getGPUs := func() ([]HostGPU, error) {
+		if hostGPUs != nil {
+			return hostGPUs, nil
+		}
+		hostGPUs, err = getHostGPUs(o.nvml)
+		return hostGPUs, err
+	}
+
+	var summaries []ClusterSummary
+	for _, name := range names {
+		summary, err := newClusterSummary(name, containersByCluster[name], getGPUs)
+		if err != nil {
+			return nil, fmt.Errorf("summarizing cluster '%v': %w", name, err)
+		}
+		if summary.Status == ClusterRunning {
+			summary.setFromConfigMap(ctx)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if summary.Status == ClusterRunning && !summary.Managed && !o.unmanaged {
+			continue
+		}
+		if !o.selector.Matches(labels.Set(summary.Labels)) {
+			continue
+		}
+		summaries = append(summaries, *summary)
+	}
+
+	return summaries, nil
+}
+
+func newClusterSummary(name string, containers []nodeContainer, getGPUs func() ([]HostGPU, error)) (*ClusterSummary, error) {
+	summary := &ClusterSummary{
+		Name: name,
+	}
+
+	running := 0
+	for _, container := range containers {
+		if container.State.Running {
+			running++
+		}
+		if summary.Created.IsZero() || container.Created.Before(summary.Created) {
+			summary.Created = container.Created
+		}
+		if container.Config.Labels[kindRoleLabel] == string(kind.WorkerRole) {
+			summary.Workers++
+		}
+
+		gpus, err := container.countGPUs(getGPUs)
+		if err != nil {
+			return nil, err
+		}
+		summary.GPUs += gpus
+	}
+
+	switch running {
+	case len(containers):
+		summary.Status = ClusterRunning
+	case 0:
+		summary.Status = ClusterStopped
+	default:
+		summary.Status = ClusterDegraded
+	}
+
+	return summary, nil
+}
+
+// countGPUs returns the number of host GPUs injected into the node container,
+// either through the volume mounts of the nvidia-container-runtime or as the
+// device nodes of CDI devices. GPUs of which only MIG devices are injected
+// count once.
+func (c *nodeContainer) countGPUs(getGPUs func() ([]HostGPU, error)) (int, error) {
+	var ids []string
+	var minors []int
+	for _, mount := range c.Mounts {
+		switch {
+		case mount.Source == "/dev/null":
+			if device := getNvidiaVisibleDevice(mount.Destination); device != "" {
+				ids = append(ids, device)
+			}
+		case nvidiaGPUDeviceNodeRegexp.MatchString(mount.Destination):
+			minor, err := strconv.Atoi(strings.TrimPrefix(mount.Destination, "/dev/nvidia"))
+			if err != nil {
+				return 0, fmt.Errorf("parsing device node minor: %w", err)
+			}
+			minors = append(minors, minor)
+		}
+	}
+	if len(ids) == 0 && len(minors) == 0 {
+		return 0, nil
+	}
+
+	gpus, err := getGPUs()
+	if err != nil {
+		return 0, fmt.Errorf("getting host GPUs: %w", err)
+	}
+	if slices.Contains(ids, "all") {
+		return len(gpus), nil
+	}
+
+	// Devices no longer found on the host count as a GPU each
+	found := sets.New[string]()
+	unresolved := sets.New[string]()
+	for _, id := range ids {
+		gpu, _, exists := resolveDevice(gpus, id)
+		if !exists {
+			unresolved.Insert(id)
+			continue
+		}
+		found.Insert(gpu.UUID)
+	}
+	for _, minor := range minors {
+		i := slices.IndexFunc(gpus, func(gpu HostGPU) bool { return gpu.Minor == minor })
+		if i == -1 {
+			unresolved.Insert(fmt.Sprintf("/dev/nvidia%d", minor))
+			continue
+		}
+		found.Insert(gpus[i].UUID)
+	}
+
+	return found.Len() + unresolved.Len(), nil
+}
+
+// setFromConfigMap marks the cluster as managed by nvkind and sets its labels
+// if it has the config stored by nvkind. Running clusters whose config cannot
+// be read (e.g. because their API server is not up yet) are marked as
+// unreachable instead.
+func (s *ClusterSummary) setFromConfigMap(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, listClustersAPITimeout)
+	defer cancel()
+
+	configMap, err := getConfigMapFromExistingCluster(ctx, s.Name)
+	if apierrors.IsNotFound(err) {
+		return
+	}
+	if err != nil {
+		s.Status = ClusterUnreachable
+		return
+	}
+
+	s.Managed = true
+	for key, value := range configMap.Labels {
+		if key == nvkindManagedByLabel {
+			continue
+		}
+		if s.Labels == nil {
+			s.Labels = make(map[string]string)
+		}
+		s.Labels[key] = value
+	}
+}
+
+func getKindNodeContainers(ctx context.Context) ([]nodeContainer, error) {
+	command := []string{
+		"docker", "ps", "--all", "--quiet",
+		"--filter", "label=" + kindClusterLabel,
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("executing command: %w", err)
+	}
+
+	ids := strings.Fields(string(output))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	command = append([]string{"docker", "inspect"}, ids...)
+	cmd = exec.CommandContext(ctx, command[0], command[1:]...)
+	output, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("executing command: %w", err)
+	}
+
+	var containers []nodeContainer
+	if err := json.Unmarshal(output, &containers); err != nil {
+		return nil, fmt.Errorf("unmarshaling JSON: %w", err)
+	}
+
+	return containers, nil
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	nvkindNamespace = "nvkind-system"
+	// nvkindLegacyNamespace is where nvkind stored the config of a cluster
+	// before its data was versioned.
+	nvkindLegacyNamespace = "default"
+	nvkindManagedByLabel  = "app.kubernetes.io/managed-by"
+
+	// nvkindClusterConfigSchemaVersion is the version of the layout of the
+	// data stored in the nvkind-cluster-config ConfigMap. It must be bumped,
+	// and a migration from the previous version added to
+	// clusterConfigMigrations, whenever the layout changes.
+	nvkindClusterConfigSchemaVersion = 1
+)
+
+// Version is the version of nvkind recorded in the clusters it creates.
+var Version = "devel"
+
+// clusterMetadata is stored alongside the config of a cluster to record when
+// and by what it was created.
+type clusterMetadata struct {
+	NvkindVersion     string    `yaml:"nvkindVersion"`
+	CreationTimestamp time.Time `yaml:"creationTimestamp"`
+	// Devices are the host devices each device of a node referred to at the
+	// time the cluster was created.
+	Devices []DeviceAssignment `yaml:"devices,omitempty"`
+}
+
+// clusterConfigMigrations[i] migrates the data of the nvkind-cluster-config
+// ConfigMap from schema version i to i+1 in place.
+var clusterConfigMigrations = []func(data map[string]string) error{
+	// Version 0 is the unversioned layout stored in the default namespace.
+	// Clusters created before the container runtime config was recorded
+	// always had nvidia set as the default runtime of containerd.
+	func(data map[string]string) error {
+		if _, exists := data[nvkindClusterConfigRuntimeKey]; exists {
+			return nil
+		}
+		runtimeBytes, err := yaml.Marshal(defaultContainerRuntimeConfig)
+		if err != nil {
+			return fmt.Errorf("marshaling YAML: %w", err)
+		}
+		data[nvkindClusterConfigRuntimeKey] = string(runtimeBytes)
+		return nil
+	},
+}
+
+func (c *Cluster) newClusterMetadata() (*clusterMetadata, error) {
+	devices, err := getDeviceAssignments(c.config, c.cdiDevices, c.nvml)
+	if err != nil {
+		return nil, fmt.Errorf("getting device assignments: %w", err)
+	}
+
+	metadata := &clusterMetadata{
+		NvkindVersion:     Version,
+		CreationTimestamp: time.Now().UTC(),
+		Devices:           devices,
+	}
+
+	return metadata, nil
+}
+
+func getClusterMetadata(data map[string]string) (*clusterMetadata, error) {
+	var metadata clusterMetadata
+	if err := yaml.Unmarshal([]byte(data[nvkindClusterConfigMetadataKey]), &metadata); err != nil {
+		return nil, fmt.Errorf("unmarshaling YAML: %w", err)
+	}
+	return &metadata, nil
+}
+
+// migrateClusterConfigData returns a copy of the data of an
+// nvkind-cluster-config ConfigMap migrated to the latest schema version.
+func migrateClusterConfigData(data map[string]string) (map[string]string, error) {
+	version := 0
+	if value, exists := data[nvkindClusterConfigSchemaVersionKey]; exists {
+		var err error
+		version, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing schema version: %w", err)
+		}
+	}
+
+	if version > nvkindClusterConfigSchemaVersion {
+		return nil, fmt.Errorf("schema version %d is newer than the latest supported version %d, upgrade nvkind to use this cluster", version, nvkindClusterConfigSchemaVersion)
+	}
+
+	migrated := make(map[string]string, len(data)+1)
+	maps.Copy(migrated, data)
+	for ; version < nvkindClusterConfigSchemaVersion; version++ {
+		if err := clusterConfigMigrations[version](migrated); err != nil {
+			return nil, fmt.Errorf("migrating from schema version %d: %w", version, err)
+		}
+	}
+	migrated[nvkindClusterConfigSchemaVersionKey] = strconv.Itoa(nvkindClusterConfigSchemaVersion)
+
+	return migrated, nil
+}
+
+func newClusterConfigMap(data, labels map[string]string) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nvkindClusterConfigName,
+			Namespace: nvkindNamespace,
+			Labels:    make(map[string]string, len(labels)+1),
+		},
+		Data: data,
+	}
+	maps.Copy(configMap.Labels, labels)
+	configMap.Labels[nvkindManagedByLabel] = "nvkind"
+	return configMap
+}
+
+func ensureNvkindNamespace(ctx context.Context, clientset kubernetes.Interface) error {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nvkindNamespace,
+			Labels: map[string]string{
+				nvkindManagedByLabel: "nvkind",
+			},
+		},
+	}
+
+	_, err := clientset.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return nil
+}
+
+// moveLegacyConfigMap moves the ConfigMap of a cluster created by an older
+// version of nvkind from the default namespace into the nvkind namespace,
+// where it can no longer be deleted by accident alongside user resources.
+func moveLegacyConfigMap(ctx context.Context, clientset kubernetes.Interface) (*corev1.ConfigMap, error) {
+	legacy, err := clientset.CoreV1().ConfigMaps(nvkindLegacyNamespace).Get(ctx, nvkindClusterConfigName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureNvkindNamespace(ctx, clientset); err != nil {
+		return nil, fmt.Errorf("creating namespace: %w", err)
+	}
+
+	configMap, err := clientset.CoreV1().ConfigMaps(nvkindNamespace).Create(ctx, newClusterConfigMap(legacy.Data, legacy.Labels), metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		configMap, err = clientset.CoreV1().ConfigMaps(nvkindNamespace).Get(ctx, nvkindClusterConfigName, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = clientset.CoreV1().ConfigMaps(nvkindLegacyNamespace).Delete(ctx, nvkindClusterConfigName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	return configMap, nil
+}
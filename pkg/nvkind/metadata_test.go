@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestMigrateClusterConfigData(t *testing.T) {
+	testCases := []struct {
+		description     string
+		data            map[string]string
+		expectedRuntime *ContainerRuntimeConfig
+		expectedError   bool
+	}{
+		{
+			description: "legacy data",
+			data: map[string]string{
+				nvkindClusterConfigKey: "kind: Cluster\n",
+			},
+			expectedRuntime: &ContainerRuntimeConfig{SetAsDefault: true},
+		},
+		{
+			description: "legacy data with container runtime config",
+			data: map[string]string{
+				nvkindClusterConfigKey:        "kind: Cluster\n",
+				nvkindClusterConfigRuntimeKey: "setAsDefault: false\ncdiEnabled: true\n",
+			},
+			expectedRuntime: &ContainerRuntimeConfig{CDIEnabled: true},
+		},
+		{
+			description: "latest schema version",
+			data: map[string]string{
+				nvkindClusterConfigSchemaVersionKey: "1",
+				nvkindClusterConfigKey:              "kind: Cluster\n",
+				nvkindClusterConfigRuntimeKey:       "setAsDefault: false\n",
+			},
+			expectedRuntime: &ContainerRuntimeConfig{},
+		},
+		{
+			description: "unknown future schema version",
+			data: map[string]string{
+				nvkindClusterConfigSchemaVersionKey: "2",
+			},
+			expectedError: true,
+		},
+		{
+			description: "invalid schema version",
+			data: map[string]string{
+				nvkindClusterConfigSchemaVersionKey: "one",
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			original := make(map[string]string)
+			for k, v := range tc.data {
+				original[k] = v
+			}
+
+			migrated, err := migrateClusterConfigData(tc.data)
+			if tc.expectedError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", migrated)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(tc.data, original) {
+				t.Errorf("input data was modified: %v", tc.data)
+			}
+			if version := migrated[nvkindClusterConfigSchemaVersionKey]; version != "1" {
+				t.Errorf("expected schema version 1, got %q", version)
+			}
+			if migrated[nvkindClusterConfigKey] != tc.data[nvkindClusterConfigKey] {
+				t.Errorf("expected config to be kept, got %q", migrated[nvkindClusterConfigKey])
+			}
+
+			var runtime ContainerRuntimeConfig
+			if err := yaml.Unmarshal([]byte(migrated[nvkindClusterConfigRuntimeKey]), &runtime); err != nil {
+				t.Fatalf("unmarshaling container runtime config: %v", err)
+			}
+			if !reflect.DeepEqual(&runtime, tc.expectedRuntime) {
+				t.Errorf("expected container runtime config %+v, got %+v", tc.expectedRuntime, runtime)
+			}
+		})
+	}
+}
@@ -17,40 +17,103 @@
 package nvkind
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 
-	"github.com/NVIDIA/go-nvlib/pkg/nvml"
 	"k8s.io/apimachinery/pkg/util/sets"
+	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+const (
+	nvidiaContainerDevicesRoot = "/var/run/nvidia-container-devices"
+	nvidiaGPUCDIKind           = "nvidia.com/gpu"
+	nodeToolkitPackagesDir     = "/var/cache/nvkind/toolkit"
+	nodeCDISpecPath            = "/var/run/cdi/nvidia.yaml"
+	nvidiaRuntimeName          = "nvidia"
 )
 
 func (n *Node) HasGPUs() bool {
 	return n.getNvidiaVisibleDevices() != nil
 }
 
-func (n *Node) InstallContainerToolkit() error {
-	err := n.runScript(`
+func (n *Node) InstallContainerToolkit(ctx context.Context) error {
+	if n.toolkit.packagesDir != "" {
+		return n.installContainerToolkitFromPackages(ctx)
+	}
+	if n.toolkit.aptMirrorDir != "" {
+		return n.installContainerToolkitFromAptMirror(ctx)
+	}
+
+	err := n.runScript(ctx, fmt.Sprintf(`
 		apt-get update
 		apt-get install -y gpg
 		curl -fsSL https://nvidia.github.io/libnvidia-container/gpgkey | gpg --dearmor -o /usr/share/keyrings/nvidia-container-toolkit-keyring.gpg
-		curl -s -L https://nvidia.github.io/libnvidia-container/experimental/deb/nvidia-container-toolkit.list | \
+		curl -s -L https://nvidia.github.io/libnvidia-container/%s/deb/nvidia-container-toolkit.list | \
 			sed 's#deb https://#deb [signed-by=/usr/share/keyrings/nvidia-container-toolkit-keyring.gpg] https://#g' | \
 				tee /etc/apt/sources.list.d/nvidia-container-toolkit.list
 		apt-get update
-		apt-get install -y nvidia-container-toolkit
-	`)
+		apt-get install -y %s
+	`, n.toolkit.channel, n.toolkit.packages()))
+	if err != nil {
+		return fmt.Errorf("running script on %v: %w", n.Name, err)
+	}
+	return nil
+}
+
+func (n *Node) installContainerToolkitFromPackages(ctx context.Context) error {
+	if err := n.copyToNode(ctx, n.toolkit.packagesDir, nodeToolkitPackagesDir); err != nil {
+		return fmt.Errorf("copying packages to %v: %w", n.Name, err)
+	}
+
+	err := n.runScript(ctx, fmt.Sprintf(`
+		dpkg -i %s/*.deb
+	`, nodeToolkitPackagesDir))
+	if err != nil {
+		return fmt.Errorf("running script on %v: %w", n.Name, err)
+	}
+	return nil
+}
+
+func (n *Node) installContainerToolkitFromAptMirror(ctx context.Context) error {
+	if err := n.copyToNode(ctx, n.toolkit.aptMirrorDir, nodeToolkitPackagesDir); err != nil {
+		return fmt.Errorf("copying apt mirror to %v: %w", n.Name, err)
+	}
+
+	// Only update the package lists from the local mirror so that no other
+	// (remote) sources are contacted
+	err := n.runScript(ctx, fmt.Sprintf(`
+		echo "deb [trusted=yes] file:%s ./" > /etc/apt/sources.list.d/nvidia-container-toolkit.list
+		apt-get update \
+			-o Dir::Etc::sourcelist=/etc/apt/sources.list.d/nvidia-container-toolkit.list \
+			-o Dir::Etc::sourceparts=- \
+			-o APT::Get::List-Cleanup=0
+		apt-get install -y --no-install-recommends %s
+	`, nodeToolkitPackagesDir, n.toolkit.packages()))
 	if err != nil {
 		return fmt.Errorf("running script on %v: %w", n.Name, err)
 	}
 	return nil
 }
 
-func (n *Node) ConfigureContainerRuntime() error {
-	err := n.runScript(`
-	    nvidia-ctk runtime configure --runtime=containerd --set-as-default
+// ConfigureContainerRuntime makes nvidia the default runtime of containerd on
+// the node if requested; everything else is set by containerdConfigPatches.
+func (n *Node) ConfigureContainerRuntime(ctx context.Context) error {
+	if err := n.configureNvidiaContainerRuntime(ctx); err != nil {
+		return err
+	}
+	if !n.runtime.SetAsDefault {
+		return nil
+	}
+	if err := n.configureContainerd(ctx); err != nil {
+		return err
+	}
+	err := n.runScript(ctx, `
 	    systemctl restart containerd
 	`)
 	if err != nil {
@@ -59,11 +122,151 @@ func (n *Node) ConfigureContainerRuntime() error {
 	return nil
 }
 
-func (n *Node) PatchProcDriverNvidia() error {
+// HasPreinstalledContainerToolkit returns true if the node was booted from an
+// image built by NodeImage.Build, i.e. one with the nvidia-container-toolkit
+// already installed and containerd already configured to use it (though not
+// necessarily the way the cluster is, see checkPreinstalledContainerRuntime).
+func (n *Node) HasPreinstalledContainerToolkit(ctx context.Context) (bool, error) {
+	version, err := n.inspect(ctx, fmt.Sprintf(`{{ index .Config.Labels %q }}`, nodeImageToolkitLabel))
+	if err != nil {
+		return false, err
+	}
+	return version != "", nil
+}
+
+// checkPreinstalledContainerRuntime returns whether the container runtime
+// config the node image was built with matches that of the cluster.
+func (n *Node) checkPreinstalledContainerRuntime(ctx context.Context) (bool, error) {
+	value, err := n.inspect(ctx, fmt.Sprintf(`{{ index .Config.Labels %q }}`, nodeImageRuntimeLabel))
+	if err != nil {
+		return false, err
+	}
+	if value == "" {
+		return false, fmt.Errorf("image does not record its container runtime config; rebuild it with 'nvkind image build'")
+	}
+
+	var imageRuntime ContainerRuntimeConfig
+	if err := json.Unmarshal([]byte(value), &imageRuntime); err != nil {
+		return false, fmt.Errorf("unmarshaling JSON: %w", err)
+	}
+
+	runtime := n.runtime.nodeImageConfig()
+	if reflect.DeepEqual(imageRuntime, runtime) {
+		return true, nil
+	}
+
+	if (imageRuntime.SetAsDefault && !runtime.SetAsDefault) ||
+		(imageRuntime.CDIEnabled && !runtime.CDIEnabled) ||
+		(len(imageRuntime.AnnotationPrefixes) != 0 && len(runtime.AnnotationPrefixes) == 0) {
+		return false, fmt.Errorf("image was built with container runtime config %s, which the cluster cannot be reconfigured from; rebuild it with 'nvkind image build' and the same container runtime flags as the cluster", value)
+	}
+
+	return false, nil
+}
+
+// GetImage returns the image the node container was created from.
+func (n *Node) GetImage(ctx context.Context) (string, error) {
+	return n.inspect(ctx, "{{ .Config.Image }}")
+}
+
+// IsProcDriverNvidiaPatched returns true if /proc/driver/nvidia is currently
+// patched on the node by PatchProcDriverNvidia. The patch does not survive a
+// restart of the node container.
+func (n *Node) IsProcDriverNvidiaPatched(ctx context.Context) (bool, error) {
+	command := []string{
+		"docker", "exec", n.Name,
+		"bash", "-c", "mountpoint -q /proc/driver/nvidia/params && echo true || echo false",
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("executing command: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)) == "true", nil
+}
+
+func (n *Node) inspect(ctx context.Context, format string) (string, error) {
+	command := []string{
+		"docker", "inspect",
+		"--format", format,
+		n.Name,
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("executing command: %w: %s", err, output)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (n *Node) configureNvidiaContainerRuntime(ctx context.Context) error {
+	if len(n.runtime.AnnotationPrefixes) == 0 {
+		return nil
+	}
+	err := n.runScript(ctx, fmt.Sprintf(`
+		nvidia-ctk config --in-place --set nvidia-container-runtime.modes.cdi.annotation-prefixes=%s
+	`, strings.Join(n.runtime.AnnotationPrefixes, ",")))
+	if err != nil {
+		return fmt.Errorf("running script on %v: %w", n.Name, err)
+	}
+	return nil
+}
+
+func (n *Node) configureContainerd(ctx context.Context) error {
+	configure := "nvidia-ctk runtime configure --runtime=containerd"
+	if n.runtime.SetAsDefault {
+		configure += " --set-as-default"
+	}
+	if n.runtime.CDIEnabled {
+		configure += " --cdi.enabled"
+	}
+
+	if err := n.runScript(ctx, configure); err != nil {
+		return fmt.Errorf("running script on %v: %w", n.Name, err)
+	}
+	return nil
+}
+
+// generateCDISpec generates a CDI spec for the GPUs visible on the node. This
+// must run after PatchProcDriverNvidia so that only the GPUs the node has
+// access to are included.
+func (n *Node) generateCDISpec(ctx context.Context) error {
+	err := n.runScript(ctx, fmt.Sprintf(`
+		mkdir -p %s
+		nvidia-ctk cdi generate --output=%s
+	`, filepath.Dir(nodeCDISpecPath), nodeCDISpecPath))
+	if err != nil {
+		return fmt.Errorf("running script on %v: %w", n.Name, err)
+	}
+	return nil
+}
+
+func (n *Node) GetContainerToolkitVersion(ctx context.Context) (string, error) {
+	command := []string{
+		"docker", "exec", n.Name,
+		"dpkg-query", "--show", "--showformat=${Version}", "nvidia-container-toolkit",
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("executing command: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (n *Node) PatchProcDriverNvidia(ctx context.Context) error {
 	// Unmount the masked /proc/driver/nvidia to allow dynamically generated
 	// MIG devices to be discovered
-	err := n.runScript(`
-		umount -R /proc/driver/nvidia
+	err := n.runScript(ctx, `
+		if mountpoint -q /proc/driver/nvidia; then
+			umount -R /proc/driver/nvidia
+		fi
 	`)
 	if err != nil {
 		return fmt.Errorf("running script on %v: %w", n.Name, err)
@@ -71,57 +274,124 @@ func (n *Node) PatchProcDriverNvidia() error {
 
 	// Make it so that calls into nvidia-smi / libnvidia-ml.so do not attempt
 	// to recreate device nodes or reset their permissions if tampered with
-	err = n.runScript(`
-		cp /proc/driver/nvidia/params root/gpu-params
-		sed -i 's/^ModifyDeviceFiles: 1$/ModifyDeviceFiles: 0/' root/gpu-params
-		mount --bind root/gpu-params /proc/driver/nvidia/params
+	err = n.runScript(ctx, `
+		if ! mountpoint -q /proc/driver/nvidia/params; then
+			cp /proc/driver/nvidia/params root/gpu-params
+			sed -i 's/^ModifyDeviceFiles: 1$/ModifyDeviceFiles: 0/' root/gpu-params
+			mount --bind root/gpu-params /proc/driver/nvidia/params
+		fi
 	`)
 	if err != nil {
 		return fmt.Errorf("running script on %v: %w", n.Name, err)
 	}
 
 	// Remove the device nodes for all GPUs except those this node has access to
-	if err := n.removeDeviceNodes(); err != nil {
+	if err := n.removeDeviceNodes(ctx); err != nil {
 		return fmt.Errorf("removing device nodes %v: %w", n.Name, err)
 	}
 
+	// Generate a CDI spec for the GPUs that remain
+	if n.runtime.GenerateCDISpec {
+		if err := n.generateCDISpec(ctx); err != nil {
+			return fmt.Errorf("generating CDI spec on %v: %w", n.Name, err)
+		}
+	}
+
 	return nil
 }
 
-func (n *Node) GetGPUInfo() ([]GPUInfo, error) {
+func (n *Node) GetGPUInfo(ctx context.Context) ([]GPUInfo, error) {
+	// The product name is queried last so that it can be split off as-is
+	// even if it contains the ", " separator used by nvidia-smi.
 	command := []string{
 		"docker", "exec", n.Name,
-		"nvidia-smi", "--query-gpu=index,name,uuid", "--format=csv,noheader",
+		"nvidia-smi", "--query-gpu=" + strings.Join(gpuInfoQueryFields, ","), "--format=csv,noheader,nounits",
 	}
 
-	cmd := exec.Command(command[0], command[1:]...)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("executing command: %w", err)
 	}
 
-	var gpuInfoList []GPUInfo
+	// What is only known on the host is filled in on a best-effort basis, so
+	// that the GPUs of the node can still be listed if it cannot be queried
+	hostGPUsByUUID := make(map[string]HostGPU)
+	hostGPUs, err := getHostGPUs(n.nvml)
+	if err != nil {
+		n.progress.logger.Error(err, "Failed to get host GPUs", "node", n.Name)
+	}
+	for _, gpu := range hostGPUs {
+		hostGPUsByUUID[gpu.UUID] = gpu
+	}
 
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	for _, line := range lines {
-		fields := strings.Split(line, ", ")
-		gpuInfo := GPUInfo{
-			Index: fields[0],
-			Name:  fields[1],
-			UUID:  fields[2],
+	cudaVersion, err := getHostCUDAVersion(n.nvml)
+	if err != nil {
+		n.progress.logger.Error(err, "Failed to get CUDA version", "node", n.Name)
+	}
+
+	var gpuInfoList []GPUInfo
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		gpuInfo, err := parseGPUInfo(line)
+		if err != nil {
+			return nil, fmt.Errorf("parsing nvidia-smi output %q: %w", line, err)
 		}
-		gpuInfoList = append(gpuInfoList, gpuInfo)
+		gpuInfo.CUDAVersion = cudaVersion
+		if hostGPU, exists := hostGPUsByUUID[gpuInfo.UUID]; exists {
+			gpuInfo.HostIndex = strconv.Itoa(hostGPU.Index)
+			gpuInfo.ComputeCapability = hostGPU.ComputeCapability
+		}
+		gpuInfoList = append(gpuInfoList, *gpuInfo)
 	}
 
 	return gpuInfoList, nil
 }
 
-func (n *Node) runScript(script string) error {
+var gpuInfoQueryFields = []string{
+	"index",
+	"uuid",
+	"memory.total",
+	"driver_version",
+	"pci.bus_id",
+	"mig.mode.current",
+	"name",
+}
+
+func parseGPUInfo(line string) (*GPUInfo, error) {
+	fields := strings.SplitN(strings.TrimSpace(line), ", ", len(gpuInfoQueryFields))
+	if len(fields) != len(gpuInfoQueryFields) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(gpuInfoQueryFields), len(fields))
+	}
+
+	memory, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parsing memory: %w", err)
+	}
+
+	pciBusID, valid := parsePCIBusID(fields[4])
+	if !valid {
+		return nil, fmt.Errorf("invalid PCI bus ID: %v", fields[4])
+	}
+
+	gpuInfo := &GPUInfo{
+		Index:         fields[0],
+		UUID:          fields[1],
+		MemoryMiB:     memory,
+		DriverVersion: fields[3],
+		PCIBusID:      pciBusID,
+		MigMode:       fields[5],
+		Name:          fields[6],
+	}
+
+	return gpuInfo, nil
+}
+
+func (n *Node) runScript(ctx context.Context, script string) error {
 	command := []string{
 		"docker", "exec", n.Name, "bash", "-c", script,
 	}
 
-	cmd := exec.Command(command[0], command[1:]...)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
 	cmd.Stdout = n.stdout
 	cmd.Stderr = n.stderr
 
@@ -132,33 +402,88 @@ func (n *Node) runScript(script string) error {
 	return nil
 }
 
-// TODO: update to support MIG (and other devices)
-func (n *Node) removeDeviceNodes() error {
-	visibleDevices := sets.New(n.getNvidiaVisibleDevices()...)
-	if visibleDevices.Has("all") {
-		return nil
+// copyToNode copies a file or directory from the host to the given path on the
+// node, replacing anything already there.
+func (n *Node) copyToNode(ctx context.Context, src, dst string) error {
+	err := n.runScript(ctx, fmt.Sprintf(`
+		rm -rf %s
+		mkdir -p %s
+	`, dst, filepath.Dir(dst)))
+	if err != nil {
+		return fmt.Errorf("preparing %v: %w", dst, err)
+	}
+
+	command := []string{
+		"docker", "cp", src, n.Name + ":" + dst,
 	}
 
-	if ret := n.nvml.Init(); ret != nvml.SUCCESS {
-		return fmt.Errorf("running nvml.Init: %w", ret)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = n.stdout
+	cmd.Stderr = n.stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("executing command: %w", err)
 	}
-	defer func() { _ = n.nvml.Shutdown() }()
 
-	numGPUs, ret := n.nvml.DeviceGetCount()
-	if ret != nvml.SUCCESS {
-		return fmt.Errorf("running nvml.DeviceGetCount: %w", ret)
+	return nil
+}
+
+func (n *Node) removeDeviceNodes(ctx context.Context) error {
+	visibleDevices := sets.New(getDeviceIDs(n.getNvidiaVisibleDevices())...)
+	if visibleDevices.Has("all") {
+		return nil
 	}
 
-	scriptFmt := `
+	gpus, err := getHostGPUs(n.nvml)
+	if err != nil {
+		return fmt.Errorf("getting host GPUs: %w", err)
+	}
+
+	gpuScriptFmt := `
 		while umount /dev/nvidia%d; do :; done || true
 		rm -rf /dev/nvidia%d
 	`
 
-	for i := 0; i < numGPUs; i++ {
-		if visibleDevices.Has(strconv.Itoa(i)) {
+	capScriptFmt := `
+		while umount /dev/nvidia-caps/nvidia-cap%d; do :; done || true
+		rm -rf /dev/nvidia-caps/nvidia-cap%d
+	`
+
+	for i := range gpus {
+		gpu := &gpus[i]
+		if visibleDevices.HasAny(gpu.visibleIDs()...) {
 			continue
 		}
-		if err := n.runScript(fmt.Sprintf(scriptFmt, i, i)); err != nil {
+
+		// Keep the capabilities of all visible MIG devices. A GPU instance
+		// capability may be shared by several compute instances, so only
+		// remove it if none of them are visible.
+		keepCaps := sets.New[int]()
+		for j := range gpu.MigDevices {
+			mig := &gpu.MigDevices[j]
+			if visibleDevices.HasAny(mig.visibleIDs(gpu)...) {
+				keepCaps.Insert(mig.GICapMinor, mig.CICapMinor)
+			}
+		}
+
+		removeCaps := sets.New[int]()
+		for _, mig := range gpu.MigDevices {
+			removeCaps.Insert(mig.GICapMinor, mig.CICapMinor)
+		}
+		removeCaps = removeCaps.Difference(keepCaps)
+
+		for _, minor := range sets.List(removeCaps) {
+			if err := n.runScript(ctx, fmt.Sprintf(capScriptFmt, minor, minor)); err != nil {
+				return fmt.Errorf("running script on %v: %w", n.Name, err)
+			}
+		}
+
+		// The parent GPU device node is required to access any of its MIG
+		// devices, so only remove it if none of them are visible.
+		if keepCaps.Len() != 0 {
+			continue
+		}
+		if err := n.runScript(ctx, fmt.Sprintf(gpuScriptFmt, gpu.Minor, gpu.Minor)); err != nil {
 			return fmt.Errorf("running script on %v: %w", n.Name, err)
 		}
 	}
@@ -166,22 +491,64 @@ func (n *Node) removeDeviceNodes() error {
 	return nil
 }
 
-// TODO: add a variant of this for CDI once support is added to kind
 func (n *Node) getNvidiaVisibleDevices() []string {
-	if n.config.ExtraMounts == nil {
-		return nil
-	}
+	return getNvidiaVisibleDevices(n.config, n.cdiDevices)
+}
 
+// getNvidiaVisibleDevices returns the devices requested by a node, either
+// through volume mounts for the nvidia-container-runtime or as CDI devices.
+func getNvidiaVisibleDevices(node *kind.Node, cdiDevices []string) []string {
 	var devices []string
-	for _, mount := range n.config.ExtraMounts {
+	for _, mount := range node.ExtraMounts {
 		if mount.HostPath != "/dev/null" {
 			continue
 		}
-		if filepath.Dir(mount.ContainerPath) != "/var/run/nvidia-container-devices" {
-			continue
+		if device := getNvidiaVisibleDevice(mount.ContainerPath); device != "" {
+			devices = append(devices, device)
 		}
-		devices = append(devices, filepath.Base(mount.ContainerPath))
 	}
+	devices = append(devices, cdiDevices...)
 
 	return devices
 }
+
+// getNvidiaVisibleDevice returns the device requested by a volume mount at the
+// given container path, i.e. <id> for /var/run/nvidia-container-devices/<id>.
+func getNvidiaVisibleDevice(containerPath string) string {
+	if filepath.Dir(containerPath) != nvidiaContainerDevicesRoot {
+		return ""
+	}
+	return filepath.Base(containerPath)
+}
+
+// getDeviceIDs strips the CDI kind from any fully qualified NVIDIA GPU CDI
+// device names so that they can be compared to plain device IDs.
+func getDeviceIDs(devices []string) []string {
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		if kind, name, found := strings.Cut(device, "="); found {
+			if kind != nvidiaGPUCDIKind {
+				continue
+			}
+			device = name
+		}
+		ids = append(ids, device)
+	}
+	return ids
+}
+
+// packages returns the list of packages to pass to apt-get install. When a
+// version is pinned, all packages the toolkit is made up of are pinned to it
+// so that apt does not pull in the latest version of any of its dependencies.
+func (t *toolkitConfig) packages() string {
+	if t.version == "" {
+		return "nvidia-container-toolkit"
+	}
+
+	var packages []string
+	for _, p := range []string{"nvidia-container-toolkit", "nvidia-container-toolkit-base", "libnvidia-container-tools", "libnvidia-container1"} {
+		packages = append(packages, fmt.Sprintf("%s=%s", p, t.version))
+	}
+
+	return strings.Join(packages, " ")
+}
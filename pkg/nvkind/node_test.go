@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGPUInfo(t *testing.T) {
+	testCases := []struct {
+		description   string
+		line          string
+		expected      *GPUInfo
+		expectedError bool
+	}{
+		{
+			description: "MIG disabled",
+			line:        "0, GPU-4cf8db2d-06c0-7d70-1a51-e59b25b2c16c, 81559, 550.54.15, 00000000:0F:00.0, Disabled, NVIDIA H100 80GB HBM3",
+			expected: &GPUInfo{
+				Index:         "0",
+				UUID:          "GPU-4cf8db2d-06c0-7d70-1a51-e59b25b2c16c",
+				MemoryMiB:     81559,
+				DriverVersion: "550.54.15",
+				PCIBusID:      "0000:0f:00.0",
+				MigMode:       "Disabled",
+				Name:          "NVIDIA H100 80GB HBM3",
+			},
+		},
+		{
+			description: "MIG not supported",
+			line:        "1, GPU-79a2ba02-a537-ccbf-2965-8e9d90c0bd54, 24564, 550.54.15, 00000000:47:00.0, [N/A], NVIDIA GeForce RTX 4090\n",
+			expected: &GPUInfo{
+				Index:         "1",
+				UUID:          "GPU-79a2ba02-a537-ccbf-2965-8e9d90c0bd54",
+				MemoryMiB:     24564,
+				DriverVersion: "550.54.15",
+				PCIBusID:      "0000:47:00.0",
+				MigMode:       "[N/A]",
+				Name:          "NVIDIA GeForce RTX 4090",
+			},
+		},
+		{
+			description: "product name with commas",
+			line:        "2, GPU-c6a6ee3c-0c1e-5b6a-8a3c-8a9d1f0e2f11, 40960, 535.161.08, 00000001:B1:00.0, Enabled, NVIDIA A100-SXM4-40GB, Rev. A, Engineering Sample",
+			expected: &GPUInfo{
+				Index:         "2",
+				UUID:          "GPU-c6a6ee3c-0c1e-5b6a-8a3c-8a9d1f0e2f11",
+				MemoryMiB:     40960,
+				DriverVersion: "535.161.08",
+				PCIBusID:      "0001:b1:00.0",
+				MigMode:       "Enabled",
+				Name:          "NVIDIA A100-SXM4-40GB, Rev. A, Engineering Sample",
+			},
+		},
+		{
+			description:   "missing fields",
+			line:          "0, GPU-4cf8db2d-06c0-7d70-1a51-e59b25b2c16c, 81559",
+			expectedError: true,
+		},
+		{
+			description:   "memory with units",
+			line:          "0, GPU-4cf8db2d-06c0-7d70-1a51-e59b25b2c16c, 81559 MiB, 550.54.15, 00000000:0F:00.0, Disabled, NVIDIA H100 80GB HBM3",
+			expectedError: true,
+		},
+		{
+			description:   "invalid PCI bus ID",
+			line:          "0, GPU-4cf8db2d-06c0-7d70-1a51-e59b25b2c16c, 81559, 550.54.15, [N/A], Disabled, NVIDIA H100 80GB HBM3",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			gpuInfo, err := parseGPUInfo(tc.line)
+			if tc.expectedError {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", gpuInfo)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(gpuInfo, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, gpuInfo)
+			}
+		})
+	}
+}
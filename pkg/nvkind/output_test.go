@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package nvkind
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	testCases := []struct {
+		description string
+		writes      []string
+		expected    string
+	}{
+		{
+			description: "single line",
+			writes:      []string{"hello\n"},
+			expected:    "[node] hello\n",
+		},
+		{
+			description: "multiple lines in one write",
+			writes:      []string{"one\ntwo\nthree\n"},
+			expected:    "[node] one\n[node] two\n[node] three\n",
+		},
+		{
+			description: "line split across writes",
+			writes:      []string{"hel", "lo\nwor", "ld\n"},
+			expected:    "[node] hello\n[node] world\n",
+		},
+		{
+			description: "partial line flushed at close",
+			writes:      []string{"one\ntw", "o"},
+			expected:    "[node] one\n[node] two\n",
+		},
+		{
+			description: "empty lines",
+			writes:      []string{"\n\n"},
+			expected:    "[node] \n[node] \n",
+		},
+		{
+			description: "nothing written",
+			expected:    "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var out bytes.Buffer
+			w := newPrefixWriter(&out, &sync.Mutex{}, "[node] ")
+			for _, s := range tc.writes {
+				n, err := w.Write([]byte(s))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if n != len(s) {
+					t.Errorf("expected %d bytes written, got %d", len(s), n)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestPrefixWriterNoPartialLineBeforeFlush(t *testing.T) {
+	var out bytes.Buffer
+	w := newPrefixWriter(&out, &sync.Mutex{}, "[node] ")
+	if _, err := w.Write([]byte("one\ntw")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "[node] one\n"; out.String() != expected {
+		t.Errorf("expected %q before flush, got %q", expected, out.String())
+	}
+}
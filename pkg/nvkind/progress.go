@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// progressReporter reports the progress of the steps of long running
+// operations to a logger and a ProgressHandler.
+type progressReporter struct {
+	logger  logr.Logger
+	handler ProgressHandler
+}
+
+// runStep runs fn as the given step on the given node (or the cluster as a
+// whole if node is empty), reporting when it starts and how it ends.
+func (p *progressReporter) runStep(node, step string, fn func() error) error {
+	logger := p.logger.WithValues("step", step)
+	if node != "" {
+		logger = logger.WithValues("node", node)
+	}
+
+	logger.Info("Step started")
+	p.emit(ProgressEvent{
+		Type: StepStarted,
+		Step: step,
+		Node: node,
+	})
+
+	start := time.Now()
+	err := fn()
+	duration := time.Since(start)
+
+	if err != nil {
+		logger.Error(err, "Step failed", "duration", duration)
+		p.emit(ProgressEvent{
+			Type:     StepFailed,
+			Step:     step,
+			Node:     node,
+			Duration: duration,
+			Err:      err,
+		})
+		return err
+	}
+
+	logger.Info("Step finished", "duration", duration)
+	p.emit(ProgressEvent{
+		Type:     StepFinished,
+		Step:     step,
+		Node:     node,
+		Duration: duration,
+	})
+
+	return nil
+}
+
+func (p *progressReporter) emit(event ProgressEvent) {
+	if p.handler != nil {
+		p.handler(event)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultProvisionParallelism = 4
+)
+
+// Provision installs and configures the nvidia-container-toolkit on each GPU
+// worker of the cluster and restricts the GPUs each one sees to those assigned
+// to it.
+func (c *Cluster) Provision(ctx context.Context, opts ...ProvisionOption) error {
+	o := ProvisionOptions{
+		parallelism: defaultProvisionParallelism,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.parallelism < 1 {
+		return fmt.Errorf("parallelism must be at least 1")
+	}
+
+	state := make(map[string]NodeProvisioningState)
+	if o.resume {
+		var err error
+		state, err = c.GetProvisioningState(ctx)
+		if err != nil {
+			return fmt.Errorf("getting provisioning state: %w", err)
+		}
+	}
+
+	nodes, err := c.GetNodes(ctx)
+	if err != nil {
+		return fmt.Errorf("getting nodes: %w", err)
+	}
+
+	var mu sync.Mutex
+	save := func(node string, nodeState NodeProvisioningState) error {
+		mu.Lock()
+		defer mu.Unlock()
+		state[node] = nodeState
+		return c.setProvisioningState(ctx, state)
+	}
+
+	err = c.forEachGPUNode(nodes, o.parallelism, func(node *Node) error {
+		mu.Lock()
+		nodeState := state[node.Name]
+		mu.Unlock()
+
+		err := node.provision(ctx, &nodeState, func() error {
+			return save(node.Name, nodeState)
+		})
+		if err != nil {
+			return fmt.Errorf("provisioning node '%v': %w", node.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.progress.runStep("", "Creating nvidia RuntimeClass", func() error {
+		return c.EnsureRuntimeClass(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("creating nvidia runtimeclass: %w", err)
+	}
+
+	err = c.progress.runStep("", "Recording container toolkit versions", func() error {
+		return c.RecordContainerToolkitVersions(ctx, nodes)
+	})
+	if err != nil {
+		return fmt.Errorf("recording container toolkit versions: %w", err)
+	}
+
+	return nil
+}
+
+// forEachGPUNode runs fn concurrently on each of the given nodes that has GPUs
+// and returns the errors of all nodes that failed.
+func (c *Cluster) forEachGPUNode(nodes []Node, parallelism int, fn func(node *Node) error) error {
+	var mu sync.Mutex
+	var outputMu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+	sem := make(chan struct{}, parallelism)
+	for _, node := range nodes {
+		if !node.HasGPUs() {
+			continue
+		}
+
+		stdout := newPrefixWriter(c.stdout, &outputMu, fmt.Sprintf("[%s] ", node.Name))
+		stderr := newPrefixWriter(c.stderr, &outputMu, fmt.Sprintf("[%s] ", node.Name))
+		node.stdout = stdout
+		node.stderr = stderr
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := fn(&node)
+			_ = stdout.Flush()
+			_ = stderr.Flush()
+
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// GetProvisioningState returns the provisioning steps recorded as completed on
+// each GPU worker of the cluster.
+func (c *Cluster) GetProvisioningState(ctx context.Context) (map[string]NodeProvisioningState, error) {
+	data, err := getConfigMapDataFromExistingCluster(ctx, c.Name)
+	if err != nil {
+		return nil, fmt.Errorf("getting configmap data: %w", err)
+	}
+
+	state := make(map[string]NodeProvisioningState)
+	if err := yaml.Unmarshal([]byte(data[nvkindClusterConfigProvisioningKey]), &state); err != nil {
+		return nil, fmt.Errorf("unmarshaling YAML: %w", err)
+	}
+
+	return state, nil
+}
+
+func (c *Cluster) setProvisioningState(ctx context.Context, state map[string]NodeProvisioningState) error {
+	stateBytes, err := yaml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshaling YAML: %w", err)
+	}
+
+	if err := updateConfigMapOfExistingCluster(ctx, c.Name, nvkindClusterConfigProvisioningKey, string(stateBytes)); err != nil {
+		return fmt.Errorf("updating configmap: %w", err)
+	}
+
+	return nil
+}
+
+// provision runs the provisioning steps not yet completed in state on the
+// node, calling save after each one.
+func (n *Node) provision(ctx context.Context, state *NodeProvisioningState, save func() error) error {
+	if !n.hasCDIDevices() {
+		state.CDIHooksApplied = true
+	}
+
+	if !state.ToolkitInstalled || !state.RuntimeConfigured {
+		preinstalled, err := n.HasPreinstalledContainerToolkit(ctx)
+		if err != nil {
+			return fmt.Errorf("checking for preinstalled container toolkit: %w", err)
+		}
+		if preinstalled {
+			state.ToolkitInstalled = true
+			// Reconfigure nodes whose image was built with a different
+			// container runtime config than that of the cluster
+			state.RuntimeConfigured, err = n.checkPreinstalledContainerRuntime(ctx)
+			if err != nil {
+				return fmt.Errorf("checking preinstalled container runtime config: %w", err)
+			}
+		}
+	}
+
+	steps := []struct {
+		done *bool
+		run  func(context.Context) error
+		desc string
+	}{
+		{&state.CDIHooksApplied, n.ApplyCDIHooks, "Applying CDI hooks"},
+		{&state.ToolkitInstalled, n.InstallContainerToolkit, "Installing container toolkit"},
+		{&state.RuntimeConfigured, n.ConfigureContainerRuntime, "Configuring container runtime"},
+		{&state.ProcDriverPatched, n.PatchProcDriverNvidia, "Patching /proc/driver/nvidia"},
+	}
+
+	for _, step := range steps {
+		if *step.done {
+			continue
+		}
+		err := n.progress.runStep(n.Name, step.desc, func() error {
+			return step.run(ctx)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", strings.ToLower(step.desc), err)
+		}
+		*step.done = true
+		if err := save(); err != nil {
+			return fmt.Errorf("saving provisioning state: %w", err)
+		}
+	}
+
+	return nil
+}
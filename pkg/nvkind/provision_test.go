@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package nvkind
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+func TestForEachGPUNode(t *testing.T) {
+	newNode := func(name string, cdiDevices ...string) Node {
+		return Node{
+			Name:       name,
+			config:     &kind.Node{Role: kind.WorkerRole},
+			cdiDevices: cdiDevices,
+		}
+	}
+	nodes := []Node{
+		newNode("control-plane"),
+		newNode("worker", "nvidia.com/gpu=0"),
+		newNode("worker2", "nvidia.com/gpu=1"),
+		newNode("worker3", "nvidia.com/gpu=2"),
+	}
+
+	var stdout bytes.Buffer
+	cluster := &Cluster{stdout: &stdout, stderr: &bytes.Buffer{}}
+
+	err := cluster.forEachGPUNode(nodes, 2, func(node *Node) error {
+		if node.Name == "control-plane" {
+			t.Errorf("called for node without GPUs")
+		}
+		fmt.Fprintf(node.stdout, "provisioning")
+		if node.Name == "worker2" {
+			return nil
+		}
+		return fmt.Errorf("failed on %v", node.Name)
+	})
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	expectedError := "failed on worker\nfailed on worker3"
+	if err.Error() != expectedError {
+		t.Errorf("expected error %q, got %q", expectedError, err.Error())
+	}
+
+	for _, name := range []string{"worker", "worker2", "worker3"} {
+		if line := fmt.Sprintf("[%s] provisioning\n", name); !strings.Contains(stdout.String(), line) {
+			t.Errorf("expected output to contain %q, got %q", line, stdout.String())
+		}
+	}
+}
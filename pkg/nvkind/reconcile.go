@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Reconcile re-applies the changes made to each GPU worker by Provision that
+// do not survive a restart of its container.
+func (c *Cluster) Reconcile(ctx context.Context, opts ...ReconcileOption) error {
+	o := ReconcileOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	nodes, err := c.GetNodes(ctx)
+	if err != nil {
+		return fmt.Errorf("getting nodes: %w", err)
+	}
+
+	if len(o.nodes) != 0 {
+		selected := sets.New(o.nodes...)
+		var filtered []Node
+		for _, node := range nodes {
+			if selected.Has(node.Name) {
+				filtered = append(filtered, node)
+				selected.Delete(node.Name)
+			}
+		}
+		if selected.Len() != 0 {
+			return fmt.Errorf("unknown nodes: %v", strings.Join(sets.List(selected), ", "))
+		}
+		nodes = filtered
+	}
+
+	return c.forEachGPUNode(nodes, defaultProvisionParallelism, func(node *Node) error {
+		if err := node.reconcile(ctx); err != nil {
+			return fmt.Errorf("reconciling node '%v': %w", node.Name, err)
+		}
+		return nil
+	})
+}
+
+// Watch reconciles each GPU worker of the cluster whenever its container is
+// started until ctx is done.
+func (c *Cluster) Watch(ctx context.Context) error {
+	nodes, err := c.GetNodes(ctx)
+	if err != nil {
+		return fmt.Errorf("getting nodes: %w", err)
+	}
+
+	gpuNodes := sets.New[string]()
+	for _, node := range nodes {
+		if node.HasGPUs() {
+			gpuNodes.Insert(node.Name)
+		}
+	}
+
+	command := []string{
+		"docker", "events",
+		"--filter", "type=container",
+		"--filter", "event=start",
+		"--filter", fmt.Sprintf("label=%s=%s", kindClusterLabel, c.Name),
+		"--format", "{{ .Actor.Attributes.name }}",
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stderr = c.stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("creating stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("executing command: %w", err)
+	}
+
+	// Catch up on any node restarted before the watch started
+	_ = c.progress.runStep("", "Reconciling all nodes", func() error {
+		return c.Reconcile(ctx)
+	})
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if !gpuNodes.Has(name) {
+			continue
+		}
+		// Failures are reported through the progress reporter
+		_ = c.progress.runStep(name, "Reconciling restarted node", func() error {
+			return c.Reconcile(ctx, WithReconcileNodes(name))
+		})
+	}
+
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("executing command: %w", err)
+	}
+
+	return ctx.Err()
+}
+
+// reconcile re-applies the changes made to the node by provisioning that do
+// not survive a restart of its container.
+func (n *Node) reconcile(ctx context.Context) error {
+	return n.progress.runStep(n.Name, "Patching /proc/driver/nvidia", func() error {
+		return n.PatchProcDriverNvidia(ctx)
+	})
+}
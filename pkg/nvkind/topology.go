@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GroupHostGPUsByNUMANode groups GPUs by the NUMA node they are attached to.
+// Groups are ordered by NUMA node, and GPUs within a group by index.
+func GroupHostGPUsByNUMANode(gpus []HostGPU) [][]HostGPU {
+	groups := make(map[int][]HostGPU)
+	for _, gpu := range gpus {
+		groups[gpu.NUMANode] = append(groups[gpu.NUMANode], gpu)
+	}
+
+	numaNodes := make([]int, 0, len(groups))
+	for numaNode := range groups {
+		numaNodes = append(numaNodes, numaNode)
+	}
+	sort.Ints(numaNodes)
+
+	result := make([][]HostGPU, 0, len(groups))
+	for _, numaNode := range numaNodes {
+		result = append(result, sortedByIndex(groups[numaNode]))
+	}
+
+	return result
+}
+
+// GroupHostGPUsByNVLink groups GPUs into NVLink domains, i.e. sets of GPUs
+// that can reach each other over NVLink, either directly or through an
+// NVSwitch. GPUs without any active NVLinks end up in a group of their own.
+// Groups are ordered by the lowest GPU index they contain.
+func GroupHostGPUsByNVLink(gpus []HostGPU) [][]HostGPU {
+	parents := make(map[string]string)
+
+	var find func(string) string
+	find = func(id string) string {
+		if _, exists := parents[id]; !exists {
+			parents[id] = id
+		}
+		if parents[id] != id {
+			parents[id] = find(parents[id])
+		}
+		return parents[id]
+	}
+
+	union := func(a, b string) {
+		parents[find(a)] = find(b)
+	}
+
+	for _, gpu := range gpus {
+		find(gpu.PCIBusID)
+		for _, remote := range gpu.NVLinkRemotes {
+			union(gpu.PCIBusID, remote)
+		}
+	}
+
+	var roots []string
+	groups := make(map[string][]HostGPU)
+	for _, gpu := range sortedByIndex(gpus) {
+		root := find(gpu.PCIBusID)
+		if _, exists := groups[root]; !exists {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], gpu)
+	}
+
+	result := make([][]HostGPU, 0, len(roots))
+	for _, root := range roots {
+		result = append(result, groups[root])
+	}
+
+	return result
+}
+
+// PartitionHostGPUs splits GPUs into n partitions whose sizes differ by at most
+// one, splitting as few NVLink domains and NUMA nodes as possible.
+func PartitionHostGPUs(gpus []HostGPU, n int) ([][]HostGPU, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("number of partitions must be positive: %v", n)
+	}
+	if n > len(gpus) {
+		return nil, fmt.Errorf("cannot split %v GPUs into %v partitions", len(gpus), n)
+	}
+
+	var domains [][]HostGPU
+	var unlinked []HostGPU
+	for _, domain := range GroupHostGPUsByNVLink(gpus) {
+		if len(domain) == 1 && len(domain[0].NVLinkRemotes) == 0 {
+			unlinked = append(unlinked, domain[0])
+			continue
+		}
+		var ordered []HostGPU
+		for _, group := range GroupHostGPUsByNUMANode(domain) {
+			ordered = append(ordered, group...)
+		}
+		domains = append(domains, ordered)
+	}
+	domains = append(domains, GroupHostGPUsByNUMANode(unlinked)...)
+
+	// Place the largest domains first, as they are the hardest to fit
+	sort.SliceStable(domains, func(i, j int) bool {
+		return len(domains[i]) > len(domains[j])
+	})
+
+	capacities := make([]int, n)
+	for i := range capacities {
+		capacities[i] = len(gpus) / n
+		if i < len(gpus)%n {
+			capacities[i]++
+		}
+	}
+
+	partitions := make([][]HostGPU, n)
+	var split [][]HostGPU
+	for _, domain := range domains {
+		best := -1
+		for i, capacity := range capacities {
+			if capacity >= len(domain) && (best == -1 || capacity < capacities[best]) {
+				best = i
+			}
+		}
+		if best == -1 {
+			split = append(split, domain)
+			continue
+		}
+		partitions[best] = append(partitions[best], domain...)
+		capacities[best] -= len(domain)
+	}
+
+	for _, domain := range split {
+		for len(domain) > 0 {
+			best := 0
+			for i, capacity := range capacities {
+				if capacity > capacities[best] {
+					best = i
+				}
+			}
+			size := min(capacities[best], len(domain))
+			partitions[best] = append(partitions[best], domain[:size]...)
+			capacities[best] -= size
+			domain = domain[size:]
+		}
+	}
+
+	for i := range partitions {
+		partitions[i] = sortedByIndex(partitions[i])
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i][0].Index < partitions[j][0].Index
+	})
+
+	return partitions, nil
+}
+
+func sortedByIndex(gpus []HostGPU) []HostGPU {
+	sorted := make([]HostGPU, len(gpus))
+	copy(sorted, gpus)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Index < sorted[j].Index
+	})
+	return sorted
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const testNVSwitchPCIBusID = "0000:c0:00.0"
+
+func testPCIBusID(index int) string {
+	return fmt.Sprintf("0000:%02x:00.0", index+1)
+}
+
+// newTestGPUs returns a GPU per NUMA node given, linked over NVLink to all
+// other GPUs of the same domain. A domain of -1 leaves a GPU without NVLinks.
+func newTestGPUs(numaNodes []int, domains []int) []HostGPU {
+	gpus := make([]HostGPU, len(numaNodes))
+	for i := range gpus {
+		gpus[i] = HostGPU{
+			Index:    i,
+			PCIBusID: testPCIBusID(i),
+			NUMANode: numaNodes[i],
+		}
+		for j := range gpus {
+			if j != i && domains[i] != -1 && domains[j] == domains[i] {
+				gpus[i].NVLinkRemotes = append(gpus[i].NVLinkRemotes, testPCIBusID(j))
+			}
+		}
+	}
+	return gpus
+}
+
+// newTestNVSwitchGPUs returns GPUs that are all linked to the same NVSwitch.
+func newTestNVSwitchGPUs(numaNodes []int) []HostGPU {
+	gpus := newTestGPUs(numaNodes, make([]int, len(numaNodes)))
+	for i := range gpus {
+		gpus[i].NVLinkRemotes = []string{testNVSwitchPCIBusID}
+	}
+	return gpus
+}
+
+func gpuIndices(groups [][]HostGPU) [][]int {
+	indices := make([][]int, 0, len(groups))
+	for _, group := range groups {
+		var ids []int
+		for _, gpu := range group {
+			ids = append(ids, gpu.Index)
+		}
+		indices = append(indices, ids)
+	}
+	return indices
+}
+
+func TestGroupHostGPUsByNVLink(t *testing.T) {
+	testCases := []struct {
+		description string
+		gpus        []HostGPU
+		expected    [][]int
+	}{
+		{
+			description: "two NVLink domains",
+			gpus:        newTestGPUs([]int{0, 0, 0, 0, 1, 1, 1, 1}, []int{0, 0, 0, 0, 1, 1, 1, 1}),
+			expected:    [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}},
+		},
+		{
+			description: "interleaved NVLink domains",
+			gpus:        newTestGPUs([]int{0, 0, 0, 0}, []int{0, 1, 0, 1}),
+			expected:    [][]int{{0, 2}, {1, 3}},
+		},
+		{
+			description: "NVSwitch",
+			gpus:        newTestNVSwitchGPUs([]int{0, 0, 0, 0, 1, 1, 1, 1}),
+			expected:    [][]int{{0, 1, 2, 3, 4, 5, 6, 7}},
+		},
+		{
+			description: "no NVLinks",
+			gpus:        newTestGPUs([]int{0, 0, 1}, []int{-1, -1, -1}),
+			expected:    [][]int{{0}, {1}, {2}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			groups := gpuIndices(GroupHostGPUsByNVLink(tc.gpus))
+			if !reflect.DeepEqual(groups, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, groups)
+			}
+		})
+	}
+}
+
+func TestGroupHostGPUsByNUMANode(t *testing.T) {
+	gpus := newTestGPUs([]int{1, 0, 1, 0}, []int{-1, -1, -1, -1})
+
+	groups := gpuIndices(GroupHostGPUsByNUMANode(gpus))
+	expected := [][]int{{1, 3}, {0, 2}}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected %v, got %v", expected, groups)
+	}
+}
+
+func TestPartitionHostGPUs(t *testing.T) {
+	twoDomains := newTestGPUs([]int{0, 0, 0, 0, 1, 1, 1, 1}, []int{0, 0, 0, 0, 1, 1, 1, 1})
+	nvswitch := newTestNVSwitchGPUs([]int{0, 0, 0, 0, 1, 1, 1, 1})
+	unlinked := newTestGPUs([]int{1, 0, 1, 0}, []int{-1, -1, -1, -1})
+
+	testCases := []struct {
+		description   string
+		gpus          []HostGPU
+		n             int
+		expected      [][]int
+		expectedError bool
+	}{
+		{
+			description: "two NVLink domains into 2",
+			gpus:        twoDomains,
+			n:           2,
+			expected:    [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}},
+		},
+		{
+			description: "two NVLink domains into 3",
+			gpus:        twoDomains,
+			n:           3,
+			expected:    [][]int{{0, 1, 2}, {3, 4, 5}, {6, 7}},
+		},
+		{
+			description: "two NVLink domains into 8",
+			gpus:        twoDomains,
+			n:           8,
+			expected:    [][]int{{0}, {1}, {2}, {3}, {4}, {5}, {6}, {7}},
+		},
+		{
+			description: "NVSwitch into 2 splits along NUMA nodes",
+			gpus:        nvswitch,
+			n:           2,
+			expected:    [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}},
+		},
+		{
+			description: "NVSwitch into 3",
+			gpus:        nvswitch,
+			n:           3,
+			expected:    [][]int{{0, 1, 2}, {3, 4, 5}, {6, 7}},
+		},
+		{
+			description: "no NVLinks groups by NUMA node",
+			gpus:        unlinked,
+			n:           2,
+			expected:    [][]int{{0, 2}, {1, 3}},
+		},
+		{
+			description: "single partition",
+			gpus:        unlinked,
+			n:           1,
+			expected:    [][]int{{0, 1, 2, 3}},
+		},
+		{
+			description:   "more partitions than GPUs",
+			gpus:          twoDomains,
+			n:             9,
+			expectedError: true,
+		},
+		{
+			description:   "zero partitions",
+			gpus:          twoDomains,
+			n:             0,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			partitions, err := PartitionHostGPUs(tc.gpus, tc.n)
+			if tc.expectedError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", gpuIndices(partitions))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if indices := gpuIndices(partitions); !reflect.DeepEqual(indices, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, indices)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvml"
+	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+// validateConfig checks every device referenced by the nodes of a cluster
+// against the GPUs available on the host. All problems found are reported
+// together rather than stopping at the first one.
+func validateConfig(cluster *kind.Cluster, cdiDevices cdiDeviceRequests, nvmllib nvml.Interface, allowSharedGPUs bool) error {
+	nodeNames := getNodeNames(cluster)
+
+	nodeDevices := make(map[string][]string)
+	for i := range cluster.Nodes {
+		if devices := getDeviceIDs(getNvidiaVisibleDevices(&cluster.Nodes[i], cdiDevices.forNode(i))); len(devices) != 0 {
+			nodeDevices[nodeNames[i]] = devices
+		}
+	}
+	if len(nodeDevices) == 0 {
+		return nil
+	}
+
+	gpus, err := getHostGPUs(nvmllib)
+	if err != nil {
+		return fmt.Errorf("getting host GPUs: %w", err)
+	}
+
+	var errs []error
+
+	// Map the UUID of each (full or MIG) device to the nodes it is assigned to
+	gpuOwners := make(map[string][]string)
+	migOwners := make(map[string][]string)
+
+	for _, nodeName := range nodeNames {
+		devices := nodeDevices[nodeName]
+		for _, device := range devices {
+			if device != "all" {
+				continue
+			}
+			if len(devices) > 1 {
+				errs = append(errs, fmt.Errorf("node %v: cannot mix 'all' with explicit devices: %v", nodeName, strings.Join(devices, ", ")))
+			}
+			for _, gpu := range gpus {
+				gpuOwners[gpu.UUID] = appendUnique(gpuOwners[gpu.UUID], nodeName)
+			}
+		}
+		for _, device := range devices {
+			if device == "all" {
+				continue
+			}
+			gpu, mig, found := resolveDevice(gpus, device)
+			if !found {
+				errs = append(errs, fmt.Errorf("node %v: device not found on host: %v", nodeName, device))
+				continue
+			}
+			if mig == nil {
+				gpuOwners[gpu.UUID] = appendUnique(gpuOwners[gpu.UUID], nodeName)
+				continue
+			}
+			migOwners[mig.UUID] = appendUnique(migOwners[mig.UUID], nodeName)
+		}
+	}
+
+	if !allowSharedGPUs {
+		for _, gpu := range gpus {
+			owners := gpuOwners[gpu.UUID]
+			if len(owners) > 1 {
+				errs = append(errs, fmt.Errorf("GPU %v (%v) assigned to multiple nodes: %v", gpu.Index, gpu.UUID, strings.Join(owners, ", ")))
+			}
+			for _, mig := range gpu.MigDevices {
+				migDeviceOwners := migOwners[mig.UUID]
+				if len(migDeviceOwners) > 1 {
+					errs = append(errs, fmt.Errorf("MIG device %v:%v (%v) assigned to multiple nodes: %v", gpu.Index, mig.Index, mig.UUID, strings.Join(migDeviceOwners, ", ")))
+				}
+				for _, migOwner := range migDeviceOwners {
+					for _, owner := range owners {
+						if owner != migOwner {
+							errs = append(errs, fmt.Errorf("MIG device %v:%v (%v) assigned to node %v while its parent GPU is assigned to node %v", gpu.Index, mig.Index, mig.UUID, migOwner, owner))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func appendUnique(list []string, item string) []string {
+	if slices.Contains(list, item) {
+		return list
+	}
+	return append(list, item)
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package nvkind
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvml"
+	kind "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+const (
+	testGPU0UUID = "GPU-4cf8db2d-06c0-7d70-1a51-e59b25b2c16c"
+	testGPU1UUID = "GPU-4404041a-04cf-1ccf-9e70-f139a9b1e23c"
+	testMIG0UUID = "MIG-c6a6ee3c-0c1e-5b6a-8a3c-8a9d1f0e2f11"
+	testMIG1UUID = "MIG-79a2ba02-a537-ccbf-2965-8e9d90c0bd54"
+)
+
+// newTestNvml returns an nvml mock with a full GPU (without MIG support) per
+// UUID given.
+func newTestNvml(uuids ...string) nvml.Interface {
+	devices := make([]nvml.Device, len(uuids))
+	for i, uuid := range uuids {
+		busID := testPCIBusID(i)
+		devices[i] = &nvml.DeviceMock{
+			GetMinorNumberFunc: func() (int, nvml.Return) { return i, nvml.SUCCESS },
+			GetUUIDFunc:        func() (string, nvml.Return) { return uuid, nvml.SUCCESS },
+			GetNameFunc:        func() (string, nvml.Return) { return "NVIDIA A100-SXM4-40GB", nvml.SUCCESS },
+			GetMemoryInfoFunc: func() (nvml.Memory, nvml.Return) {
+				return nvml.Memory{Total: 40960 * 1024 * 1024}, nvml.SUCCESS
+			},
+			GetCudaComputeCapabilityFunc: func() (int, int, nvml.Return) { return 8, 0, nvml.SUCCESS },
+			GetPciInfoFunc: func() (nvml.PciInfo, nvml.Return) {
+				var info nvml.PciInfo
+				for j, c := range busID {
+					info.BusId[j] = int8(c)
+				}
+				return info, nvml.SUCCESS
+			},
+			GetMigModeFunc: func() (int, int, nvml.Return) { return 0, 0, nvml.ERROR_NOT_SUPPORTED },
+		}
+	}
+
+	return &nvml.InterfaceMock{
+		InitFunc:           func() nvml.Return { return nvml.SUCCESS },
+		ShutdownFunc:       func() nvml.Return { return nvml.SUCCESS },
+		DeviceGetCountFunc: func() (int, nvml.Return) { return len(devices), nvml.SUCCESS },
+		DeviceGetHandleByIndexFunc: func(index int) (nvml.Device, nvml.Return) {
+			return devices[index], nvml.SUCCESS
+		},
+	}
+}
+
+func newTestNode(role kind.NodeRole, devices ...string) kind.Node {
+	node := kind.Node{Role: role}
+	for _, device := range devices {
+		node.ExtraMounts = append(node.ExtraMounts, kind.Mount{
+			HostPath:      "/dev/null",
+			ContainerPath: filepath.Join(nvidiaContainerDevicesRoot, device),
+		})
+	}
+	return node
+}
+
+func TestValidateConfig(t *testing.T) {
+	nvmllib := newTestNvml(testGPU0UUID, testGPU1UUID)
+
+	testCases := []struct {
+		description     string
+		nodes           []kind.Node
+		cdiDevices      cdiDeviceRequests
+		nvml            nvml.Interface
+		allowSharedGPUs bool
+		expectedErrors  []string
+	}{
+		{
+			description: "no GPUs requested does not query the host",
+			nodes: []kind.Node{
+				newTestNode(kind.ControlPlaneRole),
+				newTestNode(kind.WorkerRole),
+			},
+			nvml: &nvml.InterfaceMock{},
+		},
+		{
+			description: "distinct GPUs",
+			nodes: []kind.Node{
+				newTestNode(kind.ControlPlaneRole),
+				newTestNode(kind.WorkerRole, "0"),
+				newTestNode(kind.WorkerRole, testGPU1UUID),
+			},
+			nvml: nvmllib,
+		},
+		{
+			description: "GPU referenced by PCI bus ID",
+			nodes: []kind.Node{
+				newTestNode(kind.WorkerRole, testPCIBusID(1)),
+			},
+			nvml: nvmllib,
+		},
+		{
+			description: "all GPUs on a single node",
+			nodes: []kind.Node{
+				newTestNode(kind.ControlPlaneRole),
+				newTestNode(kind.WorkerRole, "all"),
+			},
+			nvml: nvmllib,
+		},
+		{
+			description: "device not found",
+			nodes: []kind.Node{
+				newTestNode(kind.WorkerRole, "0", "2"),
+			},
+			nvml: nvmllib,
+			expectedErrors: []string{
+				"node test-worker: device not found on host: 2",
+			},
+		},
+		{
+			description: "shared GPU",
+			nodes: []kind.Node{
+				newTestNode(kind.WorkerRole, "0"),
+				newTestNode(kind.WorkerRole, testGPU0UUID),
+			},
+			nvml: nvmllib,
+			expectedErrors: []string{
+				"GPU 0 (" + testGPU0UUID + ") assigned to multiple nodes: test-worker, test-worker2",
+			},
+		},
+		{
+			description: "shared GPU allowed",
+			nodes: []kind.Node{
+				newTestNode(kind.WorkerRole, "0"),
+				newTestNode(kind.WorkerRole, "0"),
+			},
+			nvml:            nvmllib,
+			allowSharedGPUs: true,
+		},
+		{
+			description: "GPU shared between a volume mount and a CDI device",
+			nodes: []kind.Node{
+				newTestNode(kind.WorkerRole, "1"),
+				newTestNode(kind.WorkerRole),
+			},
+			cdiDevices: cdiDeviceRequests{nil, {"nvidia.com/gpu=1"}},
+			nvml:       nvmllib,
+			expectedErrors: []string{
+				"GPU 1 (" + testGPU1UUID + ") assigned to multiple nodes: test-worker, test-worker2",
+			},
+		},
+		{
+			description: "all GPUs on several nodes",
+			nodes: []kind.Node{
+				newTestNode(kind.WorkerRole, "all"),
+				newTestNode(kind.WorkerRole, "1"),
+			},
+			nvml: nvmllib,
+			expectedErrors: []string{
+				"GPU 1 (" + testGPU1UUID + ") assigned to multiple nodes: test-worker, test-worker2",
+			},
+		},
+		{
+			description: "all mixed with explicit devices",
+			nodes: []kind.Node{
+				newTestNode(kind.WorkerRole, "all", "0"),
+			},
+			nvml: nvmllib,
+			expectedErrors: []string{
+				"node test-worker: cannot mix 'all' with explicit devices: all, 0",
+			},
+		},
+		{
+			description: "all problems reported together",
+			nodes: []kind.Node{
+				newTestNode(kind.WorkerRole, "0", "3"),
+				newTestNode(kind.WorkerRole, "0", "4"),
+			},
+			nvml: nvmllib,
+			expectedErrors: []string{
+				"node test-worker: device not found on host: 3",
+				"node test-worker2: device not found on host: 4",
+				"GPU 0 (" + testGPU0UUID + ") assigned to multiple nodes: test-worker, test-worker2",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			cluster := &kind.Cluster{
+				Name:  "test",
+				Nodes: tc.nodes,
+			}
+
+			err := validateConfig(cluster, tc.cdiDevices, tc.nvml, tc.allowSharedGPUs)
+			if len(tc.expectedErrors) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %v", tc.expectedErrors)
+			}
+			if expected := strings.Join(tc.expectedErrors, "\n"); err.Error() != expected {
+				t.Errorf("expected error %q, got %q", expected, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nvkind
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	nvidiaGPUResource      = "nvidia.com/gpu"
+	defaultVerifyImage     = "ubuntu:22.04"
+	defaultVerifyNamespace = "default"
+	defaultVerifyTimeout   = 5 * time.Minute
+)
+
+var nvidiaSmiUUIDRegexp = regexp.MustCompile(`\(UUID: ((?:GPU|MIG)-[^)]+)\)`)
+
+// Passed returns true if every check on every node passed.
+func (r *VerifyReport) Passed() bool {
+	for _, node := range r.Nodes {
+		if !node.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Passed returns true if every check on the node passed or was skipped.
+func (r *NodeVerifyResult) Passed() bool {
+	for _, check := range r.Checks {
+		if !check.Passed && !check.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify checks that each GPU worker of the cluster advertises and exposes
+// exactly the GPUs assigned to it; workers with MIG devices are skipped.
+func (c *Cluster) Verify(ctx context.Context, opts ...VerifyOption) (*VerifyReport, error) {
+	o := VerifyOptions{
+		image:     defaultVerifyImage,
+		namespace: defaultVerifyNamespace,
+		timeout:   defaultVerifyTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	assignments, err := getDeviceAssignments(c.config, c.cdiDevices, c.nvml)
+	if err != nil {
+		return nil, fmt.Errorf("getting device assignments: %w", err)
+	}
+
+	clientset, err := newClientsetForCluster(c.Name)
+	if err != nil {
+		return nil, fmt.Errorf("getting clientset: %w", err)
+	}
+
+	report := &VerifyReport{
+		Cluster: c.Name,
+	}
+
+	for _, name := range getNodeNames(c.config) {
+		var nodeAssignments []DeviceAssignment
+		for _, assignment := range assignments {
+			if assignment.Node == name {
+				nodeAssignments = append(nodeAssignments, assignment)
+			}
+		}
+		if len(nodeAssignments) == 0 {
+			continue
+		}
+
+		var result *NodeVerifyResult
+		err := c.progress.runStep(name, "Verifying GPUs", func() error {
+			var err error
+			result, err = c.verifyNode(ctx, clientset, name, nodeAssignments, &o)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("verifying node '%v': %w", name, err)
+		}
+		report.Nodes = append(report.Nodes, *result)
+	}
+
+	return report, nil
+}
+
+func (c *Cluster) verifyNode(ctx context.Context, clientset kubernetes.Interface, name string, assignments []DeviceAssignment, o *VerifyOptions) (*NodeVerifyResult, error) {
+	result := &NodeVerifyResult{
+		Node: name,
+	}
+
+	node, err := clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("getting node: %w", err)
+	}
+
+	var migDevices int
+	for _, assignment := range assignments {
+		if assignment.isMigDevice() {
+			migDevices++
+		}
+	}
+	if migDevices != 0 {
+		result.Checks = append(result.Checks, VerifyCheck{
+			Name:    "allocatable",
+			Skipped: true,
+			Message: fmt.Sprintf("skipped: %d MIG devices assigned, which are not advertised as %s", migDevices, nvidiaGPUResource),
+		})
+		return result, nil
+	}
+
+	expected := int64(len(assignments))
+	allocatable := node.Status.Allocatable[nvidiaGPUResource]
+	result.Checks = append(result.Checks, VerifyCheck{
+		Name:    "allocatable",
+		Passed:  allocatable.Value() == expected,
+		Message: fmt.Sprintf("%d %s allocatable, %d expected", allocatable.Value(), nvidiaGPUResource, expected),
+	})
+
+	if allocatable.Value() < expected {
+		result.Checks = append(result.Checks, VerifyCheck{
+			Name:    "pod",
+			Message: "skipped: not enough allocatable GPUs",
+		})
+		return result, nil
+	}
+
+	output, err := c.runVerifyPod(ctx, clientset, name, expected, o)
+	if err != nil {
+		result.Checks = append(result.Checks, VerifyCheck{
+			Name:    "pod",
+			Message: err.Error(),
+		})
+		return result, nil
+	}
+	result.Checks = append(result.Checks, VerifyCheck{
+		Name:    "pod",
+		Passed:  true,
+		Message: "pod ran to completion",
+	})
+
+	result.Checks = append(result.Checks, compareUUIDs(assignments, parseNvidiaSmiUUIDs(output)))
+
+	return result, nil
+}
+
+// runVerifyPod runs nvidia-smi -L in a pod on the given node requesting the
+// given number of GPUs and returns its output.
+func (c *Cluster) runVerifyPod(ctx context.Context, clientset kubernetes.Interface, node string, gpus int64, o *VerifyOptions) (string, error) {
+	pods := clientset.CoreV1().Pods(o.namespace)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "nvkind-verify-" + node,
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			NodeSelector: map[string]string{
+				corev1.LabelHostname: node,
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    "ctr",
+					Image:   o.image,
+					Command: []string{"nvidia-smi", "-L"},
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							nvidiaGPUResource: *resource.NewQuantity(gpus, resource.DecimalSI),
+						},
+					},
+				},
+			},
+		},
+	}
+	if !c.runtime.SetAsDefault {
+		runtimeClassName := nvidiaRuntimeName
+		pod.Spec.RuntimeClassName = &runtimeClassName
+	}
+
+	if err := deletePod(ctx, pods, pod.Name); err != nil {
+		return "", fmt.Errorf("deleting previous pod: %w", err)
+	}
+
+	if _, err := pods.Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("creating pod: %w", err)
+	}
+	// Clean up even if ctx was cancelled
+	defer func() { _ = deletePod(context.WithoutCancel(ctx), pods, pod.Name) }()
+
+	var phase corev1.PodPhase
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, o.timeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := pods.Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		phase = pod.Status.Phase
+		return phase == corev1.PodSucceeded || phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("waiting for pod (last phase %q): %w", phase, err)
+	}
+
+	output, err := pods.GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getting pod logs: %w", err)
+	}
+
+	if phase == corev1.PodFailed {
+		return "", fmt.Errorf("pod failed: %s", strings.TrimSpace(string(output)))
+	}
+
+	return string(output), nil
+}
+
+func deletePod(ctx context.Context, pods corev1client.PodInterface, name string) error {
+	err := pods.Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// parseNvidiaSmiUUIDs returns the UUIDs listed by nvidia-smi -L, mapped to the
+// UUID of their parent GPU for MIG devices and to "" for full GPUs.
+func parseNvidiaSmiUUIDs(output string) map[string]string {
+	uuids := make(map[string]string)
+
+	var parent string
+	for _, line := range strings.Split(output, "\n") {
+		match := nvidiaSmiUUIDRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if strings.HasPrefix(match[1], "MIG-") {
+			uuids[match[1]] = parent
+			continue
+		}
+		parent = match[1]
+		uuids[match[1]] = ""
+	}
+
+	return uuids
+}
+
+// compareUUIDs checks that the UUIDs reported from within a node are exactly
+// those of the host devices assigned to it. A GPU with an assigned MIG device
+// (or the MIG devices of an assigned GPU) is reported too and not counted as
+// unexpected.
+func compareUUIDs(assignments []DeviceAssignment, reported map[string]string) VerifyCheck {
+	var expected []string
+	for _, assignment := range assignments {
+		if assignment.UUID != "" {
+			expected = append(expected, assignment.UUID)
+		}
+	}
+
+	var missing []string
+	for _, uuid := range expected {
+		if _, exists := reported[uuid]; !exists {
+			missing = append(missing, uuid)
+		}
+	}
+
+	var unexpected []string
+	for uuid, parent := range reported {
+		if slices.Contains(expected, uuid) || slices.Contains(expected, parent) {
+			continue
+		}
+		if parent == "" && hasExpectedChild(uuid, expected, reported) {
+			continue
+		}
+		unexpected = append(unexpected, uuid)
+	}
+	slices.Sort(unexpected)
+
+	check := VerifyCheck{
+		Name:   "uuids",
+		Passed: len(missing) == 0 && len(unexpected) == 0,
+	}
+
+	var problems []string
+	if len(missing) != 0 {
+		problems = append(problems, fmt.Sprintf("missing %v", strings.Join(missing, ", ")))
+	}
+	if len(unexpected) != 0 {
+		problems = append(problems, fmt.Sprintf("unexpected %v", strings.Join(unexpected, ", ")))
+	}
+
+	if check.Passed {
+		check.Message = fmt.Sprintf("%d host devices matched", len(expected))
+	} else {
+		check.Message = strings.Join(problems, "; ")
+	}
+
+	return check
+}
+
+func hasExpectedChild(parent string, expected []string, reported map[string]string) bool {
+	for uuid, p := range reported {
+		if p == parent && slices.Contains(expected, uuid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package nvkind
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNvidiaSmiUUIDs(t *testing.T) {
+	testCases := []struct {
+		description string
+		output      string
+		expected    map[string]string
+	}{
+		{
+			description: "full GPUs",
+			output: "GPU 0: NVIDIA A100-SXM4-40GB (UUID: " + testGPU0UUID + ")\n" +
+				"GPU 1: NVIDIA A100-SXM4-40GB (UUID: " + testGPU1UUID + ")\n",
+			expected: map[string]string{
+				testGPU0UUID: "",
+				testGPU1UUID: "",
+			},
+		},
+		{
+			description: "MIG devices",
+			output: "GPU 0: NVIDIA A100-SXM4-40GB (UUID: " + testGPU0UUID + ")\n" +
+				"  MIG 1g.5gb      Device  0: (UUID: " + testMIG0UUID + ")\n" +
+				"  MIG 1g.5gb      Device  1: (UUID: " + testMIG1UUID + ")\n" +
+				"GPU 1: NVIDIA A100-SXM4-40GB (UUID: " + testGPU1UUID + ")\n",
+			expected: map[string]string{
+				testGPU0UUID: "",
+				testMIG0UUID: testGPU0UUID,
+				testMIG1UUID: testGPU0UUID,
+				testGPU1UUID: "",
+			},
+		},
+		{
+			description: "no GPUs",
+			output:      "No devices found.\n",
+			expected:    map[string]string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			uuids := parseNvidiaSmiUUIDs(tc.output)
+			if !reflect.DeepEqual(uuids, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, uuids)
+			}
+		})
+	}
+}
+
+func TestCompareUUIDs(t *testing.T) {
+	testCases := []struct {
+		description     string
+		assignments     []DeviceAssignment
+		reported        map[string]string
+		expectedPassed  bool
+		expectedMessage string
+	}{
+		{
+			description: "exact match",
+			assignments: []DeviceAssignment{{UUID: testGPU0UUID}, {UUID: testGPU1UUID}},
+			reported: map[string]string{
+				testGPU0UUID: "",
+				testGPU1UUID: "",
+			},
+			expectedPassed:  true,
+			expectedMessage: "2 host devices matched",
+		},
+		{
+			description: "missing GPU",
+			assignments: []DeviceAssignment{{UUID: testGPU0UUID}, {UUID: testGPU1UUID}},
+			reported: map[string]string{
+				testGPU0UUID: "",
+			},
+			expectedMessage: "missing " + testGPU1UUID,
+		},
+		{
+			description: "unexpected GPU",
+			assignments: []DeviceAssignment{{UUID: testGPU0UUID}},
+			reported: map[string]string{
+				testGPU0UUID: "",
+				testGPU1UUID: "",
+			},
+			expectedMessage: "unexpected " + testGPU1UUID,
+		},
+		{
+			description: "missing and unexpected GPU",
+			assignments: []DeviceAssignment{{UUID: testGPU0UUID}},
+			reported: map[string]string{
+				testGPU1UUID: "",
+			},
+			expectedMessage: "missing " + testGPU0UUID + "; unexpected " + testGPU1UUID,
+		},
+		{
+			description: "MIG devices of an assigned GPU",
+			assignments: []DeviceAssignment{{UUID: testGPU0UUID}},
+			reported: map[string]string{
+				testGPU0UUID: "",
+				testMIG0UUID: testGPU0UUID,
+				testMIG1UUID: testGPU0UUID,
+			},
+			expectedPassed:  true,
+			expectedMessage: "1 host devices matched",
+		},
+		{
+			description: "parent of an assigned MIG device",
+			assignments: []DeviceAssignment{{UUID: testMIG0UUID}},
+			reported: map[string]string{
+				testGPU0UUID: "",
+				testMIG0UUID: testGPU0UUID,
+			},
+			expectedPassed:  true,
+			expectedMessage: "1 host devices matched",
+		},
+		{
+			description: "unassigned MIG device",
+			assignments: []DeviceAssignment{{UUID: testMIG0UUID}},
+			reported: map[string]string{
+				testGPU0UUID: "",
+				testMIG0UUID: testGPU0UUID,
+				testMIG1UUID: testGPU0UUID,
+			},
+			expectedMessage: "unexpected " + testMIG1UUID,
+		},
+		{
+			description: "unresolved assignments are ignored",
+			assignments: []DeviceAssignment{{UUID: testGPU0UUID}, {Device: "all"}},
+			reported: map[string]string{
+				testGPU0UUID: "",
+			},
+			expectedPassed:  true,
+			expectedMessage: "1 host devices matched",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			check := compareUUIDs(tc.assignments, tc.reported)
+			if check.Name != "uuids" {
+				t.Errorf("expected check uuids, got %v", check.Name)
+			}
+			if check.Passed != tc.expectedPassed {
+				t.Errorf("expected passed to be %v, got %v (%v)", tc.expectedPassed, check.Passed, check.Message)
+			}
+			if check.Message != tc.expectedMessage {
+				t.Errorf("expected message %q, got %q", tc.expectedMessage, check.Message)
+			}
+		})
+	}
+}